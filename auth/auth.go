@@ -0,0 +1,112 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package auth
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// 支持的认证方式
+const (
+	TypeGeneDock = "genedock"
+	TypeBasic    = "basic"
+	TypeBearer   = "bearer"
+	TypeDigest   = "digest"
+)
+
+// Types 所有支持的认证方式
+var Types = []string{TypeGeneDock, TypeBasic, TypeBearer, TypeDigest}
+
+// Authenticator 给 request 加上认证信息
+type Authenticator interface {
+	Authenticate(req *http.Request) error
+}
+
+// Challenger 需要根据服务端返回的 401 challenge 重新发送请求的认证方式
+type Challenger interface {
+	Authenticator
+	// Challenge 处理 401 响应, 返回 true 表示需要重新认证后再发一次请求
+	Challenge(resp *http.Response) bool
+}
+
+// Credentials 各种认证方式用到的凭证
+type Credentials struct {
+	AccessKeyID     string
+	AccessKeySecret string
+	SignatureMethod string // GeneDock 签名方法, 默认为 HMACSHA1V1
+	Username        string
+	Password        string
+	Token           string
+}
+
+// New 根据认证方式创建对应的 Authenticator
+func New(authType string, cred Credentials) (Authenticator, error) {
+	switch strings.ToLower(authType) {
+	case "", TypeGeneDock:
+		method := cred.SignatureMethod
+		if method == "" {
+			method = HMACSHA1V1
+		}
+		return &Signature{
+			Method:          method,
+			AccessKeyID:     cred.AccessKeyID,
+			AccessKeySecret: cred.AccessKeySecret,
+		}, nil
+	case TypeBasic:
+		return &Basic{Username: cred.Username, Password: cred.Password}, nil
+	case TypeBearer:
+		return &Bearer{Token: cred.Token}, nil
+	case TypeDigest:
+		return &Digest{Username: cred.Username, Password: cred.Password}, nil
+	}
+	return nil, fmt.Errorf("unsupported auth type %q (choose from %s)",
+		authType, strings.Join(Types, ", "))
+}
+
+// Authenticate 使用 GeneDock HMAC 签名
+func (sign *Signature) Authenticate(req *http.Request) error {
+	return sign.SignReq(req)
+}
+
+// Basic HTTP Basic 认证
+type Basic struct {
+	Username string
+	Password string
+}
+
+// Authenticate ...
+func (b *Basic) Authenticate(req *http.Request) error {
+	req.SetBasicAuth(b.Username, b.Password)
+	return nil
+}
+
+// Bearer Bearer token 认证
+type Bearer struct {
+	Token string
+}
+
+// Authenticate ...
+func (b *Bearer) Authenticate(req *http.Request) error {
+	req.Header.Set("Authorization", "Bearer "+b.Token)
+	return nil
+}
@@ -0,0 +1,202 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package auth
+
+import (
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"net/http"
+	"strings"
+)
+
+// Digest HTTP Digest 认证 (RFC 7616), 只支持 qop=auth.
+// 第一次请求不带认证信息, 收到 401 challenge 后再带上认证信息重发
+type Digest struct {
+	Username string
+	Password string
+
+	challenge map[string]string
+	nc        int
+	retried   bool
+}
+
+// Authenticate ...
+func (d *Digest) Authenticate(req *http.Request) error {
+	if d.challenge == nil {
+		return nil
+	}
+	header, err := d.authorization(req)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", header)
+	return nil
+}
+
+// Challenge 从 WWW-Authenticate header 中取出 Digest challenge, 只重试一次
+func (d *Digest) Challenge(resp *http.Response) bool {
+	if d.retried {
+		return false
+	}
+	for _, value := range resp.Header["Www-Authenticate"] {
+		scheme, params := splitAuthHeader(value)
+		if strings.EqualFold(scheme, "Digest") {
+			d.challenge = parseAuthParams(params)
+			d.nc = 0
+			d.retried = true
+			return true
+		}
+	}
+	return false
+}
+
+func (d *Digest) authorization(req *http.Request) (string, error) {
+	cnonce, err := newCnonce()
+	if err != nil {
+		return "", err
+	}
+	return d.authorizationWithCnonce(req, cnonce)
+}
+
+// authorizationWithCnonce 使用给定的 cnonce 计算 Authorization header
+func (d *Digest) authorizationWithCnonce(req *http.Request, cnonce string) (string, error) {
+	algorithm := d.challenge["algorithm"]
+	sess := strings.HasSuffix(strings.ToUpper(algorithm), "-SESS")
+	var hashFunc func() hash.Hash
+	switch strings.TrimSuffix(strings.ToUpper(algorithm), "-SESS") {
+	case "", "MD5":
+		hashFunc = md5.New
+	case "SHA-256":
+		hashFunc = sha256.New
+	default:
+		return "", fmt.Errorf("unsupported digest algorithm %q", algorithm)
+	}
+	h := func(s string) string {
+		hf := hashFunc()
+		hf.Write([]byte(s))
+		return hex.EncodeToString(hf.Sum(nil))
+	}
+
+	realm := d.challenge["realm"]
+	nonce := d.challenge["nonce"]
+	uri := req.URL.RequestURI()
+	d.nc++
+	nc := fmt.Sprintf("%08x", d.nc)
+
+	ha1 := h(fmt.Sprintf("%s:%s:%s", d.Username, realm, d.Password))
+	if sess {
+		ha1 = h(fmt.Sprintf("%s:%s:%s", ha1, nonce, cnonce))
+	}
+	ha2 := h(fmt.Sprintf("%s:%s", req.Method, uri))
+
+	qop := ""
+	for _, q := range strings.Split(d.challenge["qop"], ",") {
+		if strings.TrimSpace(q) == "auth" {
+			qop = "auth"
+		}
+	}
+	var response string
+	if qop != "" {
+		response = h(strings.Join([]string{ha1, nonce, nc, cnonce, qop, ha2}, ":"))
+	} else {
+		response = h(strings.Join([]string{ha1, nonce, ha2}, ":"))
+	}
+
+	parts := []string{
+		fmt.Sprintf(`username="%s"`, d.Username),
+		fmt.Sprintf(`realm="%s"`, realm),
+		fmt.Sprintf(`nonce="%s"`, nonce),
+		fmt.Sprintf(`uri="%s"`, uri),
+		fmt.Sprintf(`response="%s"`, response),
+	}
+	if algorithm != "" {
+		parts = append(parts, fmt.Sprintf("algorithm=%s", algorithm))
+	}
+	if qop != "" {
+		parts = append(parts, "qop="+qop, "nc="+nc, fmt.Sprintf(`cnonce="%s"`, cnonce))
+	}
+	if opaque, ok := d.challenge["opaque"]; ok {
+		parts = append(parts, fmt.Sprintf(`opaque="%s"`, opaque))
+	}
+	return "Digest " + strings.Join(parts, ", "), nil
+}
+
+func newCnonce() (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// splitAuthHeader `Digest realm="x"` -> "Digest", `realm="x"`
+func splitAuthHeader(value string) (scheme, params string) {
+	value = strings.TrimSpace(value)
+	if i := strings.IndexByte(value, ' '); i >= 0 {
+		return value[:i], strings.TrimSpace(value[i+1:])
+	}
+	return value, ""
+}
+
+// parseAuthParams `realm="a b", qop="auth,auth-int", algorithm=MD5`
+// -> {"realm": "a b", "qop": "auth,auth-int", "algorithm": "MD5"}
+func parseAuthParams(s string) map[string]string {
+	params := map[string]string{}
+	for len(s) > 0 {
+		s = strings.TrimLeft(s, " ,")
+		eq := strings.IndexByte(s, '=')
+		if eq < 0 {
+			break
+		}
+		key := strings.ToLower(strings.TrimSpace(s[:eq]))
+		s = strings.TrimLeft(s[eq+1:], " ")
+
+		var value string
+		if strings.HasPrefix(s, `"`) {
+			var buf []byte
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				buf = append(buf, s[i])
+			}
+			value = string(buf)
+			if i < len(s) {
+				i++
+			}
+			s = s[i:]
+		} else {
+			end := strings.IndexByte(s, ',')
+			if end < 0 {
+				end = len(s)
+			}
+			value = strings.TrimSpace(s[:end])
+			s = s[end:]
+		}
+		params[key] = value
+	}
+	return params
+}
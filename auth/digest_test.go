@@ -0,0 +1,276 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package auth
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// RFC 7616 §3.9.1 中的例子
+const (
+	rfcNonce  = "7ypf/xlj9XXwfDPEoM4URrv/xwf94BcCAzFZH4GiTo0v"
+	rfcCnonce = "f2/wE4q74E6zIJEtWaHKaf5wv/H5QzzpXusqGemxURZJ"
+	rfcOpaque = "FQhe/qaU925kfnzjCev0ciny7QMkPqMAFRtzCUYo5tdS"
+)
+
+func rfcChallenge(algorithm, qop string) *http.Response {
+	value := `Digest realm="http-auth@example.org", nonce="` + rfcNonce +
+		`", opaque="` + rfcOpaque + `"`
+	if qop != "" {
+		value += `, qop="` + qop + `"`
+	}
+	if algorithm != "" {
+		value += ", algorithm=" + algorithm
+	}
+	resp := &http.Response{StatusCode: http.StatusUnauthorized, Header: http.Header{}}
+	resp.Header.Add("WWW-Authenticate", `Basic realm="http-auth@example.org"`)
+	resp.Header.Add("WWW-Authenticate", value)
+	return resp
+}
+
+func newRFCDigest(t *testing.T, algorithm, qop string) *Digest {
+	d := &Digest{Username: "Mufasa", Password: "Circle of Life"}
+	if !d.Challenge(rfcChallenge(algorithm, qop)) {
+		t.Fatalf("Challenge(%s) = false, want true", algorithm)
+	}
+	return d
+}
+
+// authParams 取出 Authorization header 中的参数
+func authParams(t *testing.T, header string) map[string]string {
+	scheme, params := splitAuthHeader(header)
+	if scheme != "Digest" {
+		t.Fatalf("Authorization = %q, want a Digest header", header)
+	}
+	return parseAuthParams(params)
+}
+
+func TestDigestRFC7616(t *testing.T) {
+	// MD5 和 SHA-256 的 response 来自 RFC 7616 §3.9.1, RFC 中没有 -sess 的例子,
+	// 它们的 response 是按 §3.4.2 用 Python 的 hashlib 计算的
+	cases := []struct {
+		algorithm string
+		response  string
+	}{
+		{"MD5", "8ca523f5e9506fed4657c9700eebdbec"},
+		{"SHA-256", "753927fa0e85d155564e2e272a28d1802ca10daf4496794697cf8db5856cb6c1"},
+		{"MD5-sess", "e783283f46242139c486a698fec7211d"},
+		{"SHA-256-sess", "2fd51b3a77ad75bad6afad6003e818d767133c46d9e2749e7f5232ae1ea3efd7"},
+		// 没有 algorithm 时默认使用 MD5
+		{"", "8ca523f5e9506fed4657c9700eebdbec"},
+	}
+	req := newTestRequest(t, "GET", "http://www.example.org/dir/index.html", "")
+	for _, c := range cases {
+		d := newRFCDigest(t, c.algorithm, "auth, auth-int")
+		header, err := d.authorizationWithCnonce(req, rfcCnonce)
+		if err != nil {
+			t.Fatalf("%s: %s", c.algorithm, err)
+		}
+		params := authParams(t, header)
+		want := map[string]string{
+			"username": "Mufasa",
+			"realm":    "http-auth@example.org",
+			"nonce":    rfcNonce,
+			"uri":      "/dir/index.html",
+			"response": c.response,
+			"qop":      "auth",
+			"nc":       "00000001",
+			"cnonce":   rfcCnonce,
+			"opaque":   rfcOpaque,
+		}
+		if c.algorithm != "" {
+			want["algorithm"] = c.algorithm
+		}
+		if !reflect.DeepEqual(params, want) {
+			t.Errorf("%s: Authorization = %q, want params %v", c.algorithm, header, want)
+		}
+	}
+}
+
+func TestDigestHeader(t *testing.T) {
+	d := newRFCDigest(t, "MD5", "auth")
+	req := newTestRequest(t, "GET", "http://www.example.org/dir/index.html", "")
+	header, err := d.authorizationWithCnonce(req, rfcCnonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `Digest username="Mufasa", realm="http-auth@example.org", nonce="` + rfcNonce +
+		`", uri="/dir/index.html", response="8ca523f5e9506fed4657c9700eebdbec", algorithm=MD5` +
+		`, qop=auth, nc=00000001, cnonce="` + rfcCnonce + `", opaque="` + rfcOpaque + `"`
+	if header != want {
+		t.Errorf("Authorization = %q, want %q", header, want)
+	}
+}
+
+func TestDigestNonceCount(t *testing.T) {
+	d := newRFCDigest(t, "MD5", "auth")
+	req := newTestRequest(t, "GET", "http://www.example.org/dir/index.html", "")
+	cases := []struct {
+		nc       string
+		response string
+	}{
+		{"00000001", "8ca523f5e9506fed4657c9700eebdbec"},
+		{"00000002", "4b5d595ecf2db9df612ea5b45cd97101"},
+	}
+	for _, c := range cases {
+		header, err := d.authorizationWithCnonce(req, rfcCnonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+		params := authParams(t, header)
+		if params["nc"] != c.nc || params["response"] != c.response {
+			t.Errorf("nc=%s, response=%s, want nc=%s, response=%s",
+				params["nc"], params["response"], c.nc, c.response)
+		}
+	}
+}
+
+func TestDigestWithoutQop(t *testing.T) {
+	// 没有 qop 时使用 RFC 2069 的算法, 不发送 qop, nc 和 cnonce
+	d := newRFCDigest(t, "MD5", "")
+	req := newTestRequest(t, "GET", "http://www.example.org/dir/index.html", "")
+	header, err := d.authorizationWithCnonce(req, rfcCnonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	params := authParams(t, header)
+	if got, want := params["response"], "7b2cc3b30e75b4777ea31027084363fd"; got != want {
+		t.Errorf("response = %q, want %q", got, want)
+	}
+	for _, key := range []string{"qop", "nc", "cnonce"} {
+		if _, ok := params[key]; ok {
+			t.Errorf("Authorization = %q should not have %s", header, key)
+		}
+	}
+
+	// 只支持 qop=auth
+	d = newRFCDigest(t, "MD5", "auth-int")
+	header, err = d.authorizationWithCnonce(req, rfcCnonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := authParams(t, header)["qop"]; ok {
+		t.Errorf("Authorization = %q should not have qop", header)
+	}
+}
+
+func TestDigestUnknownAlgorithm(t *testing.T) {
+	for _, algorithm := range []string{"SHA-512-256", "SHA-512-256-sess", "token"} {
+		d := newRFCDigest(t, algorithm, "auth")
+		req := newTestRequest(t, "GET", "http://www.example.org/dir/index.html", "")
+		err := d.Authenticate(req)
+		if err == nil || !strings.Contains(err.Error(), "unsupported digest algorithm") {
+			t.Errorf("%s: Authenticate error = %v, want unsupported digest algorithm", algorithm, err)
+		}
+		if got := req.Header.Get("Authorization"); got != "" {
+			t.Errorf("%s: Authorization = %q, want empty", algorithm, got)
+		}
+	}
+}
+
+func TestDigestChallenge(t *testing.T) {
+	d := &Digest{Username: "Mufasa", Password: "Circle of Life"}
+	req := newTestRequest(t, "GET", "http://www.example.org/dir/index.html", "")
+
+	// 收到 challenge 之前不加认证信息
+	if err := d.Authenticate(req); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("Authorization"); got != "" {
+		t.Errorf("Authorization before the challenge = %q, want empty", got)
+	}
+
+	basic := &http.Response{StatusCode: http.StatusUnauthorized, Header: http.Header{}}
+	basic.Header.Set("WWW-Authenticate", `Basic realm="x"`)
+	if d.Challenge(basic) {
+		t.Error("Challenge without a Digest challenge = true, want false")
+	}
+
+	if !d.Challenge(rfcChallenge("MD5", "auth")) {
+		t.Fatal("Challenge = false, want true")
+	}
+	if err := d.Authenticate(req); err != nil {
+		t.Fatal(err)
+	}
+	if got := req.Header.Get("Authorization"); !strings.HasPrefix(got, `Digest username="Mufasa"`) {
+		t.Errorf("Authorization = %q, want a Digest header", got)
+	}
+
+	// 只重试一次
+	if d.Challenge(rfcChallenge("MD5", "auth")) {
+		t.Error("second Challenge = true, want false")
+	}
+}
+
+func TestParseAuthParams(t *testing.T) {
+	cases := []struct {
+		s    string
+		want map[string]string
+	}{
+		{"", map[string]string{}},
+		{
+			`realm="a b", qop="auth,auth-int", algorithm=MD5`,
+			map[string]string{"realm": "a b", "qop": "auth,auth-int", "algorithm": "MD5"},
+		},
+		{
+			// 引号中的逗号和转义的引号
+			`realm="a, \"b\"", nonce="x,y" , stale=FALSE`,
+			map[string]string{"realm": `a, "b"`, "nonce": "x,y", "stale": "FALSE"},
+		},
+		{
+			// key 不区分大小写, `=` 两边可以有空格
+			`Realm = "r",NONCE=n,  opaque=""`,
+			map[string]string{"realm": "r", "nonce": "n", "opaque": ""},
+		},
+		{
+			// 没有结束的引号
+			`realm="abc`,
+			map[string]string{"realm": "abc"},
+		},
+	}
+	for _, c := range cases {
+		if got := parseAuthParams(c.s); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("parseAuthParams(%q) = %v, want %v", c.s, got, c.want)
+		}
+	}
+}
+
+func TestSplitAuthHeader(t *testing.T) {
+	cases := []struct {
+		value  string
+		scheme string
+		params string
+	}{
+		{`Digest realm="x", nonce="y"`, "Digest", `realm="x", nonce="y"`},
+		{`  Basic   realm="x" `, "Basic", `realm="x"`},
+		{"Negotiate", "Negotiate", ""},
+	}
+	for _, c := range cases {
+		scheme, params := splitAuthHeader(c.value)
+		if scheme != c.scheme || params != c.params {
+			t.Errorf("splitAuthHeader(%q) = %q, %q, want %q, %q",
+				c.value, scheme, params, c.scheme, c.params)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+// Package auth 实现 gdhttp 支持的各种认证方式
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const internalHeaderPrefix = "x-gd-"
+const internalAuthPrefix = "GeneDock"
+
+// 支持的签名方法
+const (
+	HMACSHA1V1   = "hmac-sha1-v1"
+	HMACSHA256V1 = "hmac-sha256-v1"
+)
+
+// SignatureMethods 所有支持的签名方法
+var SignatureMethods = []string{HMACSHA1V1, HMACSHA256V1}
+
+// Signature GeneDock HMAC 签名.
+//
+// 待签名的字符串 (string-to-sign) 由以下各行用 `\n` 连接而成,
+// 没有 x-gd-* headers 时省略 CanonicalHeaders 这一行:
+//
+//	METHOD
+//	Content-MD5
+//	Content-Type
+//	Date
+//	CanonicalHeaders
+//	CanonicalResource
+//
+// 签名结果为 base64(HMAC-<hash>(AccessKeySecret, string-to-sign)),
+// hash 由 Method 决定, 通过 Authorization header 发送:
+//
+//	Authorization: GeneDock <AccessKeyID>:<Signature>
+//
+// header 中不包含签名方法, 服务端需要知道每个 AccessKeyID 使用的签名方法.
+type Signature struct {
+	Method          string // 签名方法
+	AccessKeyID     string // access key id
+	AccessKeySecret string // access key secret
+	ContentMD5      bool   // 是否为 request body 计算 Content-MD5
+}
+
+// Canonical 参与签名的各个部分
+type Canonical struct {
+	Method      string
+	ContentMD5  string
+	ContentType string
+	Date        string
+	Headers     string // 规范化后的 x-gd-* headers
+	Resource    string // 规范化后的 path 和 query
+}
+
+// String 返回待签名的字符串 (string-to-sign)
+func (c Canonical) String() string {
+	msgSlice := []string{
+		c.Method, c.ContentMD5, c.ContentType, c.Date,
+	}
+	if len(c.Headers) > 0 {
+		msgSlice = append(msgSlice, c.Headers)
+	}
+	msgSlice = append(msgSlice, c.Resource)
+	return strings.Join(msgSlice, "\n")
+}
+
+// SignReq 给 req 增加签名相关的设置
+func (sign *Signature) SignReq(req *http.Request) error {
+	if sign.ContentMD5 && req.Header.Get("Content-MD5") == "" {
+		contentMD5, err := bodyMD5(req)
+		if err != nil {
+			return err
+		}
+		if contentMD5 != "" {
+			req.Header.Set("Content-MD5", contentMD5)
+		}
+	}
+	req.Header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+
+	s, err := sign.Sign(sign.Canonicalize(req))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", sign.AuthorizationHeader(s))
+	return nil
+}
+
+// Canonicalize 从 req 中取出参与签名的各个部分, Date 使用 req 中已有的值
+func (sign *Signature) Canonicalize(req *http.Request) Canonical {
+	return Canonical{
+		Method:      req.Method,
+		ContentMD5:  req.Header.Get("Content-MD5"),
+		ContentType: req.Header.Get("Content-Type"),
+		Date:        req.Header.Get("Date"),
+		Headers:     CanonicalHeaders(req.Header),
+		Resource:    CanonicalResource(req.URL),
+	}
+}
+
+// Sign 计算签名, 返回 base64 编码后的结果
+func (sign *Signature) Sign(c Canonical) (string, error) {
+	digest, err := sign.newHMACDigest(c.String())
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(digest), nil
+}
+
+// AuthorizationHeader 返回 Authorization header 的值:
+// GeneDock <AccessKeyID>:<Signature>
+func (sign *Signature) AuthorizationHeader(signStr string) string {
+	return fmt.Sprintf("%s %s:%s", internalAuthPrefix,
+		sign.AccessKeyID, signStr)
+}
+
+func (sign *Signature) newHMACDigest(msg string) (digest []byte, err error) {
+	var hashFunc func() hash.Hash
+	switch strings.ToLower(sign.Method) {
+	case "", HMACSHA1V1:
+		hashFunc = sha1.New
+	case HMACSHA256V1:
+		hashFunc = sha256.New
+	default:
+		err = fmt.Errorf("unsupported signature method %q (choose from %s)",
+			sign.Method, strings.Join(SignatureMethods, ", "))
+		return
+	}
+	h := hmac.New(hashFunc, []byte(sign.AccessKeySecret))
+	h.Write([]byte(msg))
+	digest = h.Sum(nil)
+	return
+}
+
+// CanonicalResource 返回 path 加上按 key 排序后的 query
+func CanonicalResource(u *url.URL) (uri string) {
+	uri = u.Path
+	query := u.Query()
+	if len(query) > 0 {
+		uri = fmt.Sprintf("%s?%s", uri, query.Encode())
+	}
+	return
+}
+
+// CanonicalHeaders 返回规范化后的 x-gd-* headers:
+// key 转为小写, value 去掉首尾空白, 多个 value 用 `,` 连接,
+// 按 key 排序后每行一个 `key:value`
+func CanonicalHeaders(reqHeaders http.Header) string {
+	headers := getInternalHeaders(reqHeaders)
+	sortedItems := sortMapByKey(headers)
+	sSlice := []string{}
+	for _, item := range sortedItems {
+		sSlice = append(sSlice, fmt.Sprintf("%s:%s", item[0], item[1]))
+	}
+	return strings.Join(sSlice, "\n")
+}
+
+// getInternalHeaders 获取 request headers 中自定义的 headers
+func getInternalHeaders(headers http.Header) map[string]string {
+	// 按原始 key 排序后再合并, 保证同时有非规范 key 和规范 key 时 value 的顺序固定
+	keys := []string{}
+	for key := range headers {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	internalHeaders := map[string]string{}
+	for _, rawKey := range keys {
+		values := headers[rawKey]
+		key := strings.ToLower(strings.TrimSpace(rawKey))
+		if !strings.HasPrefix(key, internalHeaderPrefix) {
+			continue
+		}
+		trimmed := []string{}
+		for _, value := range values {
+			trimmed = append(trimmed, strings.TrimSpace(value))
+		}
+		// http.Header 的 key 是规范化过的, 这里兼容直接赋值的非规范 key
+		if v, ok := internalHeaders[key]; ok {
+			trimmed = append([]string{v}, trimmed...)
+		}
+		internalHeaders[key] = strings.Join(trimmed, ",")
+	}
+	return internalHeaders
+}
+
+func sortMapByKey(m map[string]string) (sortedItems [][2]string) {
+	keys := []string{}
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		sortedItems = append(sortedItems, [2]string{key, m[key]})
+	}
+	return
+}
+
+// bodyMD5 计算 request body 的 Content-MD5, 读取后会还原 req.Body
+func bodyMD5(req *http.Request) (string, error) {
+	if req.Body == nil || req.Body == http.NoBody {
+		return "", nil
+	}
+	var body io.Reader
+	if req.GetBody != nil {
+		rc, err := req.GetBody()
+		if err != nil {
+			return "", err
+		}
+		defer rc.Close()
+		body = rc
+	} else {
+		b, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			return "", err
+		}
+		req.Body.Close()
+		req.Body = ioutil.NopCloser(bytes.NewReader(b))
+		body = bytes.NewReader(b)
+	}
+
+	h := md5.New()
+	if _, err := io.Copy(h, body); err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,205 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+const contentTypeJSON = "application/json"
+const contentTypeForm = "application/x-www-form-urlencoded"
+
+// requestBody request body. open 每次返回一个新的 reader,
+// 计算 Content-MD5 或者 digest 认证重新发送请求时会多次调用
+type requestBody struct {
+	contentType string
+	// 小于 0 表示长度未知
+	length int64
+	open   func() (io.ReadCloser, error)
+}
+
+var stdinData []byte
+var stdinRead bool
+
+// readStdin 读取 stdin 的全部内容, 只在第一次调用时读取
+func readStdin() ([]byte, error) {
+	if stdinRead {
+		return stdinData, nil
+	}
+	stdinRead = true
+	var err error
+	stdinData, err = ioutil.ReadAll(os.Stdin)
+	return stdinData, err
+}
+
+func newBytesBody(b []byte, contentType string) *requestBody {
+	return &requestBody{
+		contentType: contentType,
+		length:      int64(len(b)),
+		open: func() (io.ReadCloser, error) {
+			return ioutil.NopCloser(bytes.NewReader(b)), nil
+		},
+	}
+}
+
+// formPart multipart 表单中的一个字段, path 不为空时是文件
+type formPart struct {
+	name        string
+	value       string
+	path        string
+	size        int64
+	contentType string
+}
+
+// newMultipartBody 生成 multipart/form-data 格式的 request body.
+// 文件内容在发送请求时才读取, 不会整个读入内存; Content-Length
+// 根据各个 part 的 header 和文件大小事先算出来.
+func newMultipartBody(parts []formPart) (*requestBody, error) {
+	var length int64
+	for i := range parts {
+		p := &parts[i]
+		if p.path == "" {
+			continue
+		}
+		info, err := os.Stat(p.path)
+		if err != nil {
+			return nil, err
+		}
+		if info.IsDir() {
+			return nil, fmt.Errorf("%s is a directory", p.path)
+		}
+		p.size = info.Size()
+		if p.contentType, err = detectContentType(p.path); err != nil {
+			return nil, err
+		}
+		length += p.size
+	}
+
+	boundary := multipart.NewWriter(nil).Boundary()
+	counter := &countingWriter{}
+	if err := writeMultipart(counter, boundary, parts, false); err != nil {
+		return nil, err
+	}
+	length += counter.n
+
+	return &requestBody{
+		contentType: "multipart/form-data; boundary=" + boundary,
+		length:      length,
+		open: func() (io.ReadCloser, error) {
+			pr, pw := io.Pipe()
+			go func() {
+				pw.CloseWithError(writeMultipart(pw, boundary, parts, true))
+			}()
+			return pr, nil
+		},
+	}, nil
+}
+
+// writeMultipart 写入整个表单, withFiles 为 false 时不写入文件内容
+func writeMultipart(w io.Writer, boundary string, parts []formPart, withFiles bool) error {
+	mw := multipart.NewWriter(w)
+	if err := mw.SetBoundary(boundary); err != nil {
+		return err
+	}
+	for _, p := range parts {
+		if p.path == "" {
+			if err := mw.WriteField(p.name, p.value); err != nil {
+				return err
+			}
+			continue
+		}
+
+		h := textproto.MIMEHeader{}
+		h.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`,
+			escapeQuotes(p.name), escapeQuotes(filepath.Base(p.path))))
+		h.Set("Content-Type", p.contentType)
+		part, err := mw.CreatePart(h)
+		if err != nil {
+			return err
+		}
+		if withFiles {
+			if err = copyFile(part, p.path, p.size); err != nil {
+				return err
+			}
+		}
+	}
+	return mw.Close()
+}
+
+// copyFile 写入文件的前 size 个字节, 文件在计算 Content-Length 之后变短时报错
+func copyFile(w io.Writer, path string, size int64) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	n, err := io.Copy(w, io.LimitReader(f, size))
+	if err != nil {
+		return err
+	}
+	if n != size {
+		return fmt.Errorf("%s changed while being uploaded", path)
+	}
+	return nil
+}
+
+// detectContentType 先根据扩展名, 再根据文件内容判断文件的 MIME 类型
+func detectContentType(path string) (string, error) {
+	if t := mime.TypeByExtension(filepath.Ext(path)); t != "" {
+		return t, nil
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	buf := make([]byte, 512)
+	n, err := io.ReadFull(f, buf)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return "", err
+	}
+	return http.DetectContentType(buf[:n]), nil
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
@@ -0,0 +1,62 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/encoding/unicode"
+)
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// toUTF8 把 charset 编码的 data 转换成 UTF-8, 支持 WHATWG Encoding 标准中的
+// 所有编码, 比如 GBK, GB18030, Big5, Shift_JIS, ISO-8859-*, windows-125*, UTF-16.
+// 和浏览器一样, body 开头的 BOM 优先于 charset
+func toUTF8(data []byte, charset string) ([]byte, error) {
+	var enc encoding.Encoding
+	switch {
+	case bytes.HasPrefix(data, utf8BOM):
+		return data[len(utf8BOM):], nil
+	case bytes.HasPrefix(data, []byte{0xfe, 0xff}):
+		enc = unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM)
+	case bytes.HasPrefix(data, []byte{0xff, 0xfe}):
+		enc = unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM)
+	case charset == "":
+		return data, nil
+	default:
+		var err error
+		if enc, err = htmlindex.Get(charset); err != nil {
+			return data, fmt.Errorf("unsupported charset %q", charset)
+		}
+		if enc == unicode.UTF8 {
+			return data, nil
+		}
+	}
+	b, err := enc.NewDecoder().Bytes(data)
+	if err != nil {
+		return data, fmt.Errorf("decode %s body: %s", charset, err)
+	}
+	return b, nil
+}
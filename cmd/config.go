@@ -0,0 +1,377 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+const maskedSecret = "******"
+
+var configForce bool
+var configInitHost string
+var configInitBaseURL string
+var configShowSecrets bool
+
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage the configuration file",
+}
+
+var configWhichCmd = &cobra.Command{
+	Use:   "which URL",
+	Short: "Show which auths entry of the configuration file applies to the URL",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			exitWithError(fmt.Errorf("usage: %s", cmd.UseLine()))
+		}
+		initConfig(cmd)
+		u, err := buildURL(args[0], RequestItems{})
+		if err != nil {
+			exitWithError(err)
+		}
+
+		fmt.Printf("URL: %s\n", u)
+		if name := selectedProfileName(config); name != "" {
+			fmt.Printf("Profile: %s\n", name)
+		}
+		keys := matchAuths(config.Auths, u)
+		if len(keys) == 0 {
+			fmt.Println("No auths entry matches the URL")
+			return
+		}
+		fmt.Println("Matched auths (most specific first):")
+		for i, key := range keys {
+			mark := " "
+			if i == 0 {
+				mark = "*"
+			}
+			fmt.Printf("  %s %s\n", mark, key)
+		}
+		b, _ := json.MarshalIndent(config.Auths[keys[0]].masked(), "", "  ")
+		fmt.Println(string(b))
+	},
+}
+
+var configInitCmd = &cobra.Command{
+	Use:   "init",
+	Short: "Create the configuration file",
+	Run: func(cmd *cobra.Command, args []string) {
+		p := mustConfigPath()
+		if _, err := os.Stat(p); err == nil && !configForce {
+			exitWithError(fmt.Errorf("%s already exists, use --force to overwrite it", p))
+		}
+
+		tree := map[string]interface{}{
+			"auths":    map[string]interface{}{},
+			"profiles": map[string]interface{}{},
+		}
+		authValue := map[string]interface{}{}
+		if accessKeyID != "" {
+			authValue["accessKeyID"] = accessKeyID
+		}
+		if accessKeySecret != "" {
+			authValue["accessKeySecret"] = accessKeySecret
+		}
+		if profileName != "" {
+			profileValue := map[string]interface{}{}
+			if configInitBaseURL != "" {
+				profileValue["baseURL"] = configInitBaseURL
+			}
+			if len(authValue) > 0 {
+				profileValue["auth"] = authValue
+			}
+			tree["profiles"] = map[string]interface{}{profileName: profileValue}
+			tree["defaultProfile"] = profileName
+		} else if len(authValue) > 0 {
+			tree["auths"] = map[string]interface{}{configInitHost: authValue}
+		}
+
+		saveConfigTree(p, tree)
+		fmt.Printf("Created %s\n", p)
+	},
+}
+
+var configGetCmd = &cobra.Command{
+	Use:   "get KEY",
+	Short: "Print the value of a key, e.g. auths[localhost].accessKeyID",
+	Run: func(cmd *cobra.Command, args []string) {
+		path := mustConfigKeyArg(cmd, args, 1)
+		tree := mustReadConfigTree(mustConfigPath())
+		v, ok := getConfigValue(tree, path)
+		if !ok {
+			exitWithError(fmt.Errorf("config key %q not found", formatConfigKey(path)))
+		}
+		if s, ok := v.(string); ok {
+			fmt.Println(s)
+			return
+		}
+		b, _ := json.MarshalIndent(v, "", "    ")
+		fmt.Println(string(b))
+	},
+}
+
+var configSetCmd = &cobra.Command{
+	Use:   "set KEY VALUE",
+	Short: "Set the value of a key, e.g. profiles.dev.timeout 60",
+	Run: func(cmd *cobra.Command, args []string) {
+		path := mustConfigKeyArg(cmd, args, 2)
+		t, err := configKeyType(path)
+		if err != nil {
+			exitWithError(err)
+		}
+		p := mustConfigPath()
+		value, err := parseConfigValue(t, args[1])
+		if err != nil {
+			exitWithError(&configError{path: p, msg: fmt.Sprintf("%s: %s", formatConfigKey(path), err)})
+		}
+
+		tree := mustReadConfigTree(p)
+		if err = setConfigValue(tree, path, value); err != nil {
+			exitWithError(err)
+		}
+		checkConfigRewrite(p)
+		saveConfigTree(p, tree)
+	},
+}
+
+var configUnsetCmd = &cobra.Command{
+	Use:   "unset KEY",
+	Short: "Remove a key",
+	Run: func(cmd *cobra.Command, args []string) {
+		path := mustConfigKeyArg(cmd, args, 1)
+		p := mustConfigPath()
+		tree := mustReadConfigTree(p)
+		if !unsetConfigValue(tree, path) {
+			exitWithError(fmt.Errorf("config key %q not found", formatConfigKey(path)))
+		}
+		checkConfigRewrite(p)
+		saveConfigTree(p, tree)
+	},
+}
+
+var configListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List all keys and values, secrets are hidden unless --show-secrets is given",
+	Run: func(cmd *cobra.Command, args []string) {
+		tree := mustReadConfigTree(mustConfigPath())
+		for _, line := range flattenConfig(tree, []string{}, configShowSecrets) {
+			fmt.Println(line)
+		}
+	},
+}
+
+var configValidateCmd = &cobra.Command{
+	Use:   "validate",
+	Short: "Check the configuration file for errors",
+	Run: func(cmd *cobra.Command, args []string) {
+		p := mustConfigPath()
+		data, err := ioutil.ReadFile(p)
+		if err != nil {
+			exitWithError(err)
+		}
+		errs := validateConfig(p, data)
+		for _, err := range errs {
+			fmt.Println(err)
+		}
+		if len(errs) > 0 {
+			os.Exit(1)
+		}
+		fmt.Printf("%s is valid\n", p)
+	},
+}
+
+var configEditCmd = &cobra.Command{
+	Use:   "edit",
+	Short: "Edit the configuration file with $VISUAL or $EDITOR",
+	Run: func(cmd *cobra.Command, args []string) {
+		p := mustConfigPath()
+		data, err := ioutil.ReadFile(p)
+		if err != nil && !os.IsNotExist(err) {
+			exitWithError(err)
+		}
+
+		// 编辑临时文件, 检查通过后才替换配置文件
+		f, err := ioutil.TempFile("", "gdhttp-config-*"+filepath.Ext(p))
+		if err != nil {
+			exitWithError(err)
+		}
+		tmp := f.Name()
+		f.Chmod(configFileMode)
+		f.Write(data)
+		f.Close()
+
+		if err = runEditor(tmp); err != nil {
+			os.Remove(tmp)
+			exitWithError(err)
+		}
+		edited, err := ioutil.ReadFile(tmp)
+		if err != nil {
+			exitWithError(err)
+		}
+		if errs := validateConfig(p, edited); len(errs) > 0 {
+			for _, err := range errs {
+				fmt.Println(err)
+			}
+			exitWithError(fmt.Errorf("the configuration file is not changed, your edits are kept in %s", tmp))
+		}
+		os.Remove(tmp)
+		if err = writeConfigFile(p, edited); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+func init() {
+	configInitCmd.Flags().BoolVarP(&configForce, "force", "f", false, "Overwrite the existing configuration file")
+	configInitCmd.Flags().StringVar(&configInitHost, "host", defaultHost, "The auths entry for --access-key-id and --access-key-secret")
+	configInitCmd.Flags().StringVar(&configInitBaseURL, "base-url", "", "The base URL of the profile given by --profile")
+	configSetCmd.Flags().BoolVarP(&configForce, "force", "f", false, "Rewrite a YAML or TOML file even if its comments are lost")
+	configUnsetCmd.Flags().BoolVarP(&configForce, "force", "f", false, "Rewrite a YAML or TOML file even if its comments are lost")
+	configListCmd.Flags().BoolVar(&configShowSecrets, "show-secrets", false, "Show secrets instead of hiding them")
+
+	configCmd.AddCommand(
+		configInitCmd,
+		configGetCmd,
+		configSetCmd,
+		configUnsetCmd,
+		configListCmd,
+		configValidateCmd,
+		configEditCmd,
+		configWhichCmd,
+	)
+	RootCmd.AddCommand(configCmd)
+}
+
+func mustConfigPath() string {
+	p, err := configPath()
+	if err != nil {
+		exitWithError(err)
+	}
+	return p
+}
+
+func mustConfigKeyArg(cmd *cobra.Command, args []string, n int) []string {
+	if len(args) != n {
+		exitWithError(fmt.Errorf("usage: %s", cmd.UseLine()))
+	}
+	path, err := parseConfigKey(args[0])
+	if err != nil {
+		exitWithError(err)
+	}
+	return path
+}
+
+func mustReadConfigTree(p string) map[string]interface{} {
+	tree, err := readConfigTree(p)
+	if err != nil {
+		exitWithError(err)
+	}
+	return tree
+}
+
+// checkConfigRewrite set 和 unset 会重新生成整个 YAML 或 TOML 文件, 注释会丢失,
+// key 的顺序也会改变, 有注释时除非指定了 --force 否则拒绝修改
+func checkConfigRewrite(p string) {
+	if configForce || configFormat(p) == configFormatJSON {
+		return
+	}
+	data, err := ioutil.ReadFile(p)
+	if err != nil || !hasConfigComments(data) {
+		return
+	}
+	exitWithError(fmt.Errorf("%s has comments which would be lost by rewriting it, "+
+		"use 'gdhttp config edit' instead or --force to rewrite it anyway", p))
+}
+
+// saveConfigTree 检查通过后写入配置文件
+func saveConfigTree(p string, tree map[string]interface{}) {
+	data, err := encodeConfigTree(p, tree)
+	if err != nil {
+		exitWithError(err)
+	}
+	if errs := validateConfig(p, data); len(errs) > 0 {
+		msgs := []string{}
+		for _, err := range errs {
+			msgs = append(msgs, err.Error())
+		}
+		exitWithError(errors.New(strings.Join(msgs, "\n")))
+	}
+	if err = writeConfigFile(p, data); err != nil {
+		exitWithError(err)
+	}
+}
+
+func runEditor(p string) error {
+	editor := os.Getenv("VISUAL")
+	if editor == "" {
+		editor = os.Getenv("EDITOR")
+	}
+	if editor == "" {
+		editor = "vi"
+		if runtime.GOOS == "windows" {
+			editor = "notepad"
+		}
+	}
+
+	command := editor + " " + shellQuote(filepath.ToSlash(p))
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.Command("cmd", "/C", command)
+	} else {
+		c = exec.Command("sh", "-c", command)
+	}
+	c.Stdin = os.Stdin
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	return c.Run()
+}
+
+func shellQuote(s string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + s + `"`
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
+
+// masked 返回隐藏了 secret 的配置, 用于显示
+func (a configAuth) masked() configAuth {
+	if a.AccessKeySecret != "" {
+		a.AccessKeySecret = maskedSecret
+	}
+	if a.Password != "" {
+		a.Password = maskedSecret
+	}
+	if a.Token != "" {
+		a.Token = maskedSecret
+	}
+	return a
+}
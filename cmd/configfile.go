@@ -0,0 +1,421 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"bitbucket.org/mozillazg/gdhttp/auth"
+)
+
+const configFileMode = 0600
+
+// configError 配置文件中的错误, line 和 column 从 1 开始, 为 0 时表示位置未知
+type configError struct {
+	path   string
+	line   int
+	column int
+	msg    string
+}
+
+func (e *configError) Error() string {
+	if e.line > 0 && e.column > 0 {
+		return fmt.Sprintf("%s:%d:%d: %s", e.path, e.line, e.column, e.msg)
+	}
+	if e.line > 0 {
+		return fmt.Sprintf("%s:%d: %s", e.path, e.line, e.msg)
+	}
+	return fmt.Sprintf("%s: %s", e.path, e.msg)
+}
+
+// newConfigError 把 json 的错误转换为带行号和列号的错误,
+// data 为 nil 时 (非 JSON 格式的配置文件) 不计算位置
+func newConfigError(p string, data []byte, err error) error {
+	if e, ok := err.(*configError); ok {
+		return e
+	}
+	e := &configError{path: p, msg: err.Error()}
+	var offset int64 = -1
+	switch err := err.(type) {
+	case *json.SyntaxError:
+		offset = err.Offset
+	case *json.UnmarshalTypeError:
+		offset = err.Offset
+		if err.Field != "" {
+			e.msg = fmt.Sprintf("cannot use %s as %s for field %q",
+				err.Value, err.Type, err.Field)
+		}
+	}
+	if offset >= 0 && data != nil {
+		e.line, e.column = lineColumn(data, offset)
+	}
+	return e
+}
+
+// lineColumn 把字节偏移量转换为行号和列号
+func lineColumn(data []byte, offset int64) (line, column int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line = bytes.Count(before, []byte("\n")) + 1
+	column = int(offset) - (bytes.LastIndex(before, []byte("\n")) + 1)
+	if column < 1 {
+		column = 1
+	}
+	return
+}
+
+// configPath 返回配置文件的绝对路径, 未指定 --config 时使用第一个存在的
+// 配置文件, 都不存在时使用 defaultConfigPath
+func configPath() (string, error) {
+	if cfgFile != "" {
+		return absPathify(cfgFile)
+	}
+	for _, p := range configCandidates() {
+		p, err := absPathify(p)
+		if err != nil {
+			continue
+		}
+		if _, err = os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return absPathify(defaultConfigPath)
+}
+
+// readConfigTree 读取配置文件为 map, 用于修改配置文件时保留未知的字段.
+// 配置文件不存在时返回空的 map
+func readConfigTree(p string) (tree map[string]interface{}, err error) {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]interface{}{}, nil
+		}
+		return
+	}
+	return decodeConfigTree(p, data)
+}
+
+// writeConfigFile 先写入同一目录下的临时文件再重命名, 保证写入是原子的
+func writeConfigFile(p string, data []byte) error {
+	dir := filepath.Dir(p)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := ioutil.TempFile(dir, "."+filepath.Base(p)+".")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	defer os.Remove(tmp)
+
+	if err = f.Chmod(configFileMode); err == nil {
+		if _, err = f.Write(data); err == nil {
+			err = f.Sync()
+		}
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmp, p)
+}
+
+// validateConfig 检查配置文件的格式和内容, 返回所有发现的问题
+func validateConfig(p string, data []byte) (errs []error) {
+	jsonData, err := configJSON(p, data)
+	if err != nil {
+		return []error{err}
+	}
+	if configFormat(p) != configFormatJSON {
+		data = nil
+	}
+	var config Config
+	decoder := json.NewDecoder(bytes.NewReader(jsonData))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&config); err != nil {
+		return []error{newConfigError(p, data, err)}
+	}
+
+	invalid := func(format string, a ...interface{}) {
+		errs = append(errs, &configError{path: p, msg: fmt.Sprintf(format, a...)})
+	}
+	checkAuth := func(name string, a configAuth) {
+		if _, err := auth.New(a.Type, auth.Credentials{}); err != nil {
+			invalid("%s: %s", name, err)
+		}
+		if a.SignatureMethod != "" {
+			sign := auth.Signature{Method: a.SignatureMethod}
+			if _, err := sign.Sign(auth.Canonical{}); err != nil {
+				invalid("%s: %s", name, err)
+			}
+		}
+	}
+
+	for _, key := range sortedKeys(config.Auths) {
+		if _, err := parseHostRule(key); err != nil {
+			invalid("auths: %s", err)
+		}
+		checkAuth(fmt.Sprintf("auths[%s]", key), config.Auths[key])
+	}
+	for _, name := range sortedKeys(config.Profiles) {
+		profile := config.Profiles[name]
+		if profile.BaseURL != "" {
+			if u, err := url.Parse(profile.BaseURL); err != nil || u.Scheme == "" || u.Host == "" {
+				invalid("profiles[%s].baseURL: invalid URL %q", name, profile.BaseURL)
+			}
+		}
+		if profile.Timeout < 0 {
+			invalid("profiles[%s].timeout: must not be negative", name)
+		}
+		checkAuth(fmt.Sprintf("profiles[%s].auth", name), profile.Auth)
+	}
+	if config.DefaultProfile != "" {
+		if _, ok := config.Profiles[config.DefaultProfile]; !ok {
+			invalid("defaultProfile: profile %q not found", config.DefaultProfile)
+		}
+	}
+	return
+}
+
+func sortedKeys(m interface{}) []string {
+	keys := []string{}
+	for _, k := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, k.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// parseConfigKey 解析 `config get/set` 使用的 key, 用 `.` 分隔,
+// 包含 `.` 的部分可以用 `[]` 括起来或者用 `\.` 转义:
+// auths[api.example.com].accessKeyID -> ["auths", "api.example.com", "accessKeyID"]
+func parseConfigKey(s string) (path []string, err error) {
+	var seg bytes.Buffer
+	pending := false
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			i++
+			seg.WriteByte(s[i])
+			pending = true
+		case c == '.':
+			if !pending {
+				return nil, fmt.Errorf("invalid config key %q", s)
+			}
+			path = append(path, seg.String())
+			seg.Reset()
+			pending = false
+		case c == '[':
+			end := strings.IndexByte(s[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid config key %q: missing ']'", s)
+			}
+			if pending {
+				path = append(path, seg.String())
+				seg.Reset()
+			}
+			seg.WriteString(s[i+1 : i+end])
+			pending = true
+			i += end
+		default:
+			seg.WriteByte(c)
+			pending = true
+		}
+	}
+	if !pending {
+		return nil, fmt.Errorf("invalid config key %q", s)
+	}
+	return append(path, seg.String()), nil
+}
+
+// formatConfigKey 是 parseConfigKey 的逆操作
+func formatConfigKey(path []string) string {
+	s := ""
+	for i, seg := range path {
+		switch {
+		case strings.ContainsAny(seg, ".[]"):
+			s += "[" + seg + "]"
+		case i > 0:
+			s += "." + seg
+		default:
+			s += seg
+		}
+	}
+	return s
+}
+
+// configKeyType 根据 Config 的定义返回 key 对应的类型
+func configKeyType(path []string) (reflect.Type, error) {
+	t := reflect.TypeOf(Config{})
+	for i, seg := range path {
+		switch t.Kind() {
+		case reflect.Struct:
+			field, ok := jsonField(t, seg)
+			if !ok {
+				return nil, fmt.Errorf("unknown config key %q", formatConfigKey(path[:i+1]))
+			}
+			t = field.Type
+		case reflect.Map:
+			t = t.Elem()
+		default:
+			return nil, fmt.Errorf("config key %q is not an object", formatConfigKey(path[:i]))
+		}
+	}
+	return t, nil
+}
+
+func jsonField(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := strings.Split(field.Tag.Get("json"), ",")[0]
+		if tag == name {
+			return field, true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// parseConfigValue 把命令行中的字符串转换为 t 类型对应的 JSON 值
+func parseConfigValue(t reflect.Type, s string) (v interface{}, err error) {
+	switch t.Kind() {
+	case reflect.String:
+		return s, nil
+	case reflect.Bool:
+		if v, err = strconv.ParseBool(s); err != nil {
+			return nil, fmt.Errorf("invalid value %q, expected a boolean (true or false)", s)
+		}
+		return v, nil
+	case reflect.Int, reflect.Int64:
+		if v, err = strconv.ParseInt(s, 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid value %q, expected an integer", s)
+		}
+		return v, nil
+	}
+	if err = json.Unmarshal([]byte(s), &v); err != nil {
+		return nil, fmt.Errorf("invalid value %q, expected a JSON object: %s", s, err)
+	}
+	if _, ok := v.(map[string]interface{}); !ok {
+		return nil, fmt.Errorf("invalid value %q, expected a JSON object", s)
+	}
+	return v, nil
+}
+
+func getConfigValue(tree map[string]interface{}, path []string) (interface{}, bool) {
+	var v interface{} = tree
+	for _, seg := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil, false
+		}
+		if v, ok = m[seg]; !ok {
+			return nil, false
+		}
+	}
+	return v, true
+}
+
+func setConfigValue(tree map[string]interface{}, path []string, value interface{}) error {
+	m := tree
+	for i, seg := range path[:len(path)-1] {
+		next, ok := m[seg]
+		if !ok {
+			next = map[string]interface{}{}
+			m[seg] = next
+		}
+		if m, ok = next.(map[string]interface{}); !ok {
+			return fmt.Errorf("config key %q is not an object", formatConfigKey(path[:i+1]))
+		}
+	}
+	m[path[len(path)-1]] = value
+	return nil
+}
+
+func unsetConfigValue(tree map[string]interface{}, path []string) bool {
+	v, ok := getConfigValue(tree, path[:len(path)-1])
+	if !ok {
+		return false
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		return false
+	}
+	if _, ok = m[path[len(path)-1]]; !ok {
+		return false
+	}
+	delete(m, path[len(path)-1])
+	return true
+}
+
+// flattenConfig 把配置展开为每行一个 `key = value` 的形式, showSecrets 为 false 时隐藏 secret
+func flattenConfig(v interface{}, path []string, showSecrets bool) (lines []string) {
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		value, _ := json.Marshal(v)
+		if s, ok := v.(string); ok {
+			value = []byte(listValue(s))
+			if !showSecrets && isSecretKey(path[len(path)-1]) && s != "" {
+				value = []byte(maskedSecret)
+			}
+		}
+		return []string{fmt.Sprintf("%s = %s", formatConfigKey(path), value)}
+	}
+	for _, key := range sortedKeys(m) {
+		lines = append(lines, flattenConfig(m[key], append(path[:len(path):len(path)], key), showSecrets)...)
+	}
+	return
+}
+
+// listValue 字符串原样输出, 包含换行之类的控制字符, 首尾有空白或者以引号开头时
+// 输出带引号和转义的字符串, 保证每个值只占一行并且不会有歧义
+func listValue(s string) string {
+	if s != strings.TrimSpace(s) || strings.HasPrefix(s, `"`) {
+		return strconv.Quote(s)
+	}
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return strconv.Quote(s)
+		}
+	}
+	return s
+}
+
+func isSecretKey(key string) bool {
+	switch key {
+	case "accessKeySecret", "password", "token":
+		return true
+	}
+	return false
+}
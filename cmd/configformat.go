@@ -0,0 +1,225 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v2"
+)
+
+// 支持的配置文件格式, 根据扩展名判断, 默认为 JSON
+const (
+	configFormatJSON = "json"
+	configFormatYAML = "yaml"
+	configFormatTOML = "toml"
+)
+
+var configExtensions = []string{".json", ".yaml", ".yml", ".toml"}
+
+var reErrorLine = regexp.MustCompile(`line (\d+)`)
+
+func configFormat(p string) string {
+	switch strings.ToLower(filepath.Ext(p)) {
+	case ".yaml", ".yml":
+		return configFormatYAML
+	case ".toml":
+		return configFormatTOML
+	}
+	return configFormatJSON
+}
+
+// configCandidates 未指定 --config 时依次查找的配置文件:
+// $XDG_CONFIG_HOME/gdhttp/config.{json,yaml,yml,toml},
+// $HOME/.gdhttp.{json,yaml,yml,toml}
+func configCandidates() []string {
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	if xdg == "" {
+		xdg = "$HOME/.config"
+	}
+	candidates := []string{}
+	for _, ext := range configExtensions {
+		candidates = append(candidates, filepath.Join(xdg, "gdhttp", "config"+ext))
+	}
+	for _, ext := range configExtensions {
+		candidates = append(candidates, "$HOME/.gdhttp"+ext)
+	}
+	return candidates
+}
+
+// decodeConfigTree 按配置文件的格式解析为 map
+func decodeConfigTree(p string, data []byte) (tree map[string]interface{}, err error) {
+	tree = map[string]interface{}{}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return
+	}
+
+	switch configFormat(p) {
+	case configFormatYAML:
+		var v interface{}
+		if err = yaml.Unmarshal(data, &v); err != nil {
+			return nil, newFormatError(p, err)
+		}
+		m, ok := normalizeConfigValue(v).(map[string]interface{})
+		if !ok {
+			return nil, &configError{path: p, msg: "the top level must be a mapping"}
+		}
+		tree = m
+	case configFormatTOML:
+		if _, err = toml.Decode(string(data), &tree); err != nil {
+			return nil, newFormatError(p, err)
+		}
+		tree = normalizeConfigValue(tree).(map[string]interface{})
+	default:
+		if err = json.Unmarshal(data, &tree); err != nil {
+			return nil, newConfigError(p, data, err)
+		}
+	}
+	return
+}
+
+// configJSON 把任意格式的配置文件内容转换为 JSON, 以便使用同一个 Config 定义
+func configJSON(p string, data []byte) ([]byte, error) {
+	if configFormat(p) == configFormatJSON {
+		return data, nil
+	}
+	tree, err := decodeConfigTree(p, data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(tree)
+}
+
+// encodeConfigTree 按配置文件的格式序列化
+func encodeConfigTree(p string, tree map[string]interface{}) ([]byte, error) {
+	switch configFormat(p) {
+	case configFormatYAML:
+		return yaml.Marshal(integralConfigValue(tree))
+	case configFormatTOML:
+		var buf bytes.Buffer
+		if err := toml.NewEncoder(&buf).Encode(integralConfigValue(tree)); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	data, err := json.MarshalIndent(tree, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	return append(data, '\n'), nil
+}
+
+// hasConfigComments YAML 和 TOML 的内容中是否有 `#` 注释, 忽略引号中的 `#`.
+// 多行字符串中的 `#` 也会被当作注释, 宁可多拒绝也不丢掉注释
+func hasConfigComments(data []byte) bool {
+	for _, line := range strings.Split(string(data), "\n") {
+		var quote rune
+		escaped := false
+		// 引号只在值的开头表示字符串, 比如 `name: it's` 中的不是
+		prev := ':'
+		for i, c := range line {
+			switch {
+			case escaped:
+				escaped = false
+			case quote == '"' && c == '\\':
+				escaped = true
+			case quote != 0:
+				if c == quote {
+					quote = 0
+				}
+			case (c == '"' || c == '\'') && strings.ContainsRune(":-=[{,", prev):
+				quote = c
+			case c == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+				return true
+			}
+			if c != ' ' && c != '\t' {
+				prev = c
+			}
+		}
+	}
+	return false
+}
+
+// newFormatError 从 YAML 和 TOML 的错误信息中取出行号
+func newFormatError(p string, err error) *configError {
+	e := &configError{path: p, msg: err.Error()}
+	if m := reErrorLine.FindStringSubmatch(e.msg); m != nil {
+		e.line, _ = strconv.Atoi(m[1])
+	}
+	return e
+}
+
+// normalizeConfigValue 把 YAML 解析出的 map[interface{}]interface{}
+// 转换为 map[string]interface{}
+func normalizeConfigValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := map[string]interface{}{}
+		for key, value := range v {
+			m[fmt.Sprint(key)] = normalizeConfigValue(value)
+		}
+		return m
+	case map[string]interface{}:
+		for key, value := range v {
+			v[key] = normalizeConfigValue(value)
+		}
+		return v
+	case []interface{}:
+		for i, value := range v {
+			v[i] = normalizeConfigValue(value)
+		}
+		return v
+	}
+	return v
+}
+
+// integralConfigValue 把 JSON 解析出的整数值从 float64 转换为 int64,
+// 避免写入 YAML 和 TOML 时变成 `60.0`
+func integralConfigValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		m := map[string]interface{}{}
+		for key, value := range v {
+			m[key] = integralConfigValue(value)
+		}
+		return m
+	case []interface{}:
+		s := make([]interface{}, len(v))
+		for i, value := range v {
+			s[i] = integralConfigValue(value)
+		}
+		return s
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<53 {
+			return int64(v)
+		}
+	}
+	return v
+}
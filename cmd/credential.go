@@ -0,0 +1,125 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"bitbucket.org/mozillazg/gdhttp/auth"
+)
+
+const accessKeyIDEnv = "GDHTTP_ACCESS_KEY_ID"
+const accessKeySecretEnv = "GDHTTP_ACCESS_KEY_SECRET"
+
+// useAuth value 中有当前的认证方式所需的完整凭证时使用 value 中的凭证,
+// 认证方式和签名方法, --auth-type 和 --signature-method 优先
+func useAuth(value configAuth) bool {
+	t := authType
+	if t == "" {
+		t = value.Type
+	}
+	switch strings.ToLower(t) {
+	case "", auth.TypeGeneDock:
+		if value.AccessKeyID == "" || value.AccessKeySecret == "" {
+			return false
+		}
+	default:
+		if value.credentials() == "" {
+			return false
+		}
+	}
+	accessKeyID, accessKeySecret = value.AccessKeyID, value.AccessKeySecret
+	authCredentials = value.credentials()
+	authType = t
+	if signatureMethod == "" {
+		signatureMethod = value.SignatureMethod
+	}
+	return true
+}
+
+// runCredentialHelper 以类似 git-credential 的协议调用外部命令获取凭证:
+// 执行 `<helper> get`, 通过 stdin 传入
+//
+//	protocol=https
+//	host=example.com:8080
+//	path=api/v1/jobs
+//
+// 然后从 stdout 读取 `key=value` 格式的结果, key 与配置文件中 auths 的字段相同,
+// 比如 accessKeyID, accessKeySecret, username, password, token.
+func runCredentialHelper(helper string, u *url.URL) (value configAuth, err error) {
+	var input bytes.Buffer
+	fmt.Fprintf(&input, "protocol=%s\n", u.Scheme)
+	fmt.Fprintf(&input, "host=%s\n", u.Host)
+	fmt.Fprintf(&input, "path=%s\n", strings.TrimLeft(u.Path, "/"))
+	input.WriteString("\n")
+
+	command := helper + " get"
+	var c *exec.Cmd
+	if runtime.GOOS == "windows" {
+		c = exec.Command("cmd", "/C", command)
+	} else {
+		c = exec.Command("sh", "-c", command)
+	}
+	c.Stdin = &input
+	c.Stderr = os.Stderr
+	output, err := c.Output()
+	if err != nil {
+		err = fmt.Errorf("credential helper %q: %s", helper, err)
+		return
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			break
+		}
+		arr := strings.SplitN(line, "=", 2)
+		if len(arr) != 2 {
+			continue
+		}
+		switch arr[0] {
+		case "type":
+			value.Type = arr[1]
+		case "accessKeyID":
+			value.AccessKeyID = arr[1]
+		case "accessKeySecret":
+			value.AccessKeySecret = arr[1]
+		case "signatureMethod":
+			value.SignatureMethod = arr[1]
+		case "username":
+			value.Username = arr[1]
+		case "password":
+			value.Password = arr[1]
+		case "token":
+			value.Token = arr[1]
+		}
+	}
+	err = scanner.Err()
+	return
+}
@@ -0,0 +1,363 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"net/http"
+	"net/http/httputil"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+const progressInterval = 200 * time.Millisecond
+
+// Digest header (RFC 3230) 支持的算法
+var digestAlgorithms = map[string]func() hash.Hash{
+	"md5":     md5.New,
+	"sha":     sha1.New,
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// downloader 把 response body 写入文件的 Hook, 响应头和进度输出到 stderr
+type downloader struct {
+	dump   *DumpConfig
+	output string
+	resume bool
+	// 续传时已下载的字节数
+	offset int64
+	err    error
+}
+
+func newDownloader(dump *DumpConfig, output string, resume bool) (*downloader, error) {
+	d := &downloader{dump: dump, output: output, resume: resume}
+	if !resume {
+		return d, nil
+	}
+	if output == "" {
+		return nil, errors.New("--continue requires --output")
+	}
+	info, err := os.Stat(output)
+	if err == nil {
+		d.offset = info.Size()
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return d, nil
+}
+
+// rangeHeader 续传时请求剩余部分的 Range header
+func (d *downloader) rangeHeader() string {
+	if d.offset == 0 {
+		return ""
+	}
+	return fmt.Sprintf("bytes=%d-", d.offset)
+}
+
+func (d *downloader) before(req *http.Request) {
+	d.dump.before(req)
+}
+
+func (d *downloader) after(resp *http.Response) {
+	if d.dump.responseHeaders {
+		b, _ := httputil.DumpResponse(resp, false)
+		fmt.Fprint(os.Stderr, string(b))
+	}
+	d.err = d.save(resp)
+}
+
+func (d *downloader) save(resp *http.Response) (err error) {
+	switch {
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && d.offset > 0:
+		fmt.Fprintf(os.Stderr, "%s is already fully downloaded\n", d.output)
+		return nil
+	case resp.StatusCode == http.StatusPartialContent && d.offset > 0:
+		start, _, err := parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+		if start != d.offset {
+			return fmt.Errorf("the server resumed at byte %d instead of %d", start, d.offset)
+		}
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		io.Copy(os.Stderr, io.LimitReader(resp.Body, 64<<10))
+		fmt.Fprintln(os.Stderr)
+		return fmt.Errorf("download failed: %s", resp.Status)
+	default:
+		// 服务端不支持 Range 时重新下载整个文件
+		d.offset = 0
+	}
+
+	p := d.output
+	if p == "" {
+		if p, err = downloadFileName(resp); err != nil {
+			return err
+		}
+	}
+	flag := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if d.offset > 0 {
+		flag = os.O_WRONLY | os.O_APPEND
+	}
+	f, err := os.OpenFile(p, flag, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	c, err := newChecksums(resp.Header, p, d.offset)
+	if err != nil {
+		return err
+	}
+	total := int64(-1)
+	if resp.ContentLength >= 0 {
+		total = d.offset + resp.ContentLength
+	}
+	progress := newProgress(p, d.offset, total)
+	n, err := io.Copy(io.MultiWriter(f, c, progress), resp.Body)
+	progress.done()
+	if err != nil {
+		return err
+	}
+	if err = f.Sync(); err != nil {
+		return err
+	}
+	if err = c.verify(); err != nil {
+		return fmt.Errorf("%s: %s", p, err)
+	}
+	fmt.Fprintf(os.Stderr, "Downloaded %s to %s\n", formatBytes(d.offset+n), p)
+	return nil
+}
+
+// parseContentRange 解析 `bytes 100-999/1000`, 总长度未知时返回 -1
+func parseContentRange(s string) (start, total int64, err error) {
+	invalid := fmt.Errorf("invalid Content-Range %q", s)
+	if !strings.HasPrefix(s, "bytes ") {
+		return 0, 0, invalid
+	}
+	arr := strings.SplitN(strings.TrimPrefix(s, "bytes "), "/", 2)
+	if len(arr) != 2 {
+		return 0, 0, invalid
+	}
+	bounds := strings.SplitN(arr[0], "-", 2)
+	if start, err = strconv.ParseInt(bounds[0], 10, 64); err != nil {
+		return 0, 0, invalid
+	}
+	total = -1
+	if arr[1] != "*" {
+		if total, err = strconv.ParseInt(arr[1], 10, 64); err != nil {
+			return 0, 0, invalid
+		}
+	}
+	return start, total, nil
+}
+
+// downloadFileName 依次使用 Content-Disposition 中的文件名和 URL 的最后一段
+// 作为文件名, 文件已经存在时加上 `-1`, `-2` 这样的后缀
+func downloadFileName(resp *http.Response) (string, error) {
+	name := ""
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil {
+		name = params["filename"]
+	}
+	if name == "" {
+		name = path.Base(resp.Request.URL.Path)
+	}
+	// 不允许服务端指定其他目录
+	name = filepath.Base(filepath.Clean("/" + name))
+	if name == "" || name == "/" || name == "." || name == string(filepath.Separator) {
+		name = "index"
+	}
+
+	ext := filepath.Ext(name)
+	base := strings.TrimSuffix(name, ext)
+	for i := 0; ; i++ {
+		p := name
+		if i > 0 {
+			p = fmt.Sprintf("%s-%d%s", base, i, ext)
+		}
+		if _, err := os.Stat(p); os.IsNotExist(err) {
+			return p, nil
+		} else if err != nil {
+			return "", err
+		}
+	}
+}
+
+// checksums 计算下载内容的校验和: Content-MD5 只包含本次收到的内容,
+// Digest 是整个文件的校验和, 续传时包含已下载的部分
+type checksums struct {
+	contentMD5 string
+	md5        hash.Hash
+	digests    map[string]string
+	hashes     map[string]hash.Hash
+}
+
+func newChecksums(h http.Header, p string, offset int64) (*checksums, error) {
+	c := &checksums{
+		contentMD5: h.Get("Content-MD5"),
+		digests:    map[string]string{},
+		hashes:     map[string]hash.Hash{},
+	}
+	if c.contentMD5 != "" {
+		c.md5 = md5.New()
+	}
+	for _, value := range h["Digest"] {
+		for _, item := range strings.Split(value, ",") {
+			arr := strings.SplitN(strings.TrimSpace(item), "=", 2)
+			algorithm := strings.ToLower(arr[0])
+			if newHash, ok := digestAlgorithms[algorithm]; ok && len(arr) == 2 {
+				c.digests[algorithm] = arr[1]
+				c.hashes[algorithm] = newHash()
+			}
+		}
+	}
+	if len(c.hashes) == 0 || offset == 0 {
+		return c, nil
+	}
+
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	if _, err = io.CopyN(c.digestWriter(), f, offset); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *checksums) digestWriter() io.Writer {
+	writers := []io.Writer{}
+	for _, h := range c.hashes {
+		writers = append(writers, h)
+	}
+	return io.MultiWriter(writers...)
+}
+
+func (c *checksums) Write(p []byte) (int, error) {
+	if c.md5 != nil {
+		c.md5.Write(p)
+	}
+	for _, h := range c.hashes {
+		h.Write(p)
+	}
+	return len(p), nil
+}
+
+func (c *checksums) verify() error {
+	if c.md5 != nil {
+		if s := base64.StdEncoding.EncodeToString(c.md5.Sum(nil)); s != c.contentMD5 {
+			return fmt.Errorf("Content-MD5 mismatch: expected %s, got %s", c.contentMD5, s)
+		}
+	}
+	for algorithm, h := range c.hashes {
+		if s := base64.StdEncoding.EncodeToString(h.Sum(nil)); s != c.digests[algorithm] {
+			return fmt.Errorf("Digest %s mismatch: expected %s, got %s", algorithm, c.digests[algorithm], s)
+		}
+	}
+	return nil
+}
+
+// progress 在 stderr 是终端时显示下载进度
+type progress struct {
+	name    string
+	enabled bool
+	start   time.Time
+	last    time.Time
+	// 本次开始时已有的字节数, 不计入速度
+	offset  int64
+	written int64
+	total   int64
+}
+
+func newProgress(name string, offset, total int64) *progress {
+	return &progress{
+		name:    name,
+		enabled: isatty.IsTerminal(os.Stderr.Fd()),
+		start:   time.Now(),
+		offset:  offset,
+		total:   total,
+	}
+}
+
+func (p *progress) Write(b []byte) (int, error) {
+	p.written += int64(len(b))
+	if p.enabled && time.Since(p.last) >= progressInterval {
+		p.last = time.Now()
+		p.render()
+	}
+	return len(b), nil
+}
+
+func (p *progress) done() {
+	if p.enabled {
+		p.render()
+		fmt.Fprintln(os.Stderr)
+	}
+}
+
+func (p *progress) render() {
+	current := p.offset + p.written
+	elapsed := time.Since(p.start).Seconds()
+	speed := float64(0)
+	if elapsed > 0 {
+		speed = float64(p.written) / elapsed
+	}
+	line := fmt.Sprintf("%s  %s", p.name, formatBytes(current))
+	if p.total > 0 {
+		line += fmt.Sprintf(" / %s  %3d%%", formatBytes(p.total), current*100/p.total)
+	}
+	line += fmt.Sprintf("  %s/s", formatBytes(int64(speed)))
+	if p.total > 0 && speed > 0 {
+		eta := time.Duration(float64(p.total-current)/speed) * time.Second
+		line += fmt.Sprintf("  ETA %s", eta)
+	}
+	// \x1b[K 清除上一次输出剩下的字符
+	fmt.Fprintf(os.Stderr, "\r%s\x1b[K", line)
+}
+
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,138 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+)
+
+// acceptEncoding 请求时声明支持的 Content-Encoding. 因为显式设置了
+// Accept-Encoding, http.Transport 不会自动解压, 由 decodeBody 解压
+const acceptEncoding = "gzip, deflate, br"
+
+// contentDecoders 按 Content-Encoding 注册的解压方法
+var contentDecoders = map[string]func(r *bufio.Reader) (io.Reader, error){
+	"gzip":    gzipDecoder,
+	"x-gzip":  gzipDecoder,
+	"deflate": deflateDecoder,
+	"br":      brotliDecoder,
+}
+
+func gzipDecoder(r *bufio.Reader) (io.Reader, error) {
+	return gzip.NewReader(r)
+}
+
+// deflateDecoder HTTP 的 deflate 是 zlib 格式, 但是有的服务器直接发送
+// 没有 zlib 头的 deflate 数据, 两种都支持
+func deflateDecoder(r *bufio.Reader) (io.Reader, error) {
+	head, _ := r.Peek(2)
+	if len(head) == 2 && head[0]&0x0f == 8 && (uint16(head[0])<<8|uint16(head[1]))%31 == 0 {
+		return zlib.NewReader(r)
+	}
+	return flate.NewReader(r), nil
+}
+
+func brotliDecoder(r *bufio.Reader) (io.Reader, error) {
+	return brotli.NewReader(r), nil
+}
+
+// unsupportedEncodingError 不支持的 Content-Encoding, 这时 body 还没有被读取
+type unsupportedEncodingError string
+
+func (e unsupportedEncodingError) Error() string {
+	return fmt.Sprintf("unsupported Content-Encoding %q", string(e))
+}
+
+// decodedBody 解压后的 response body, 同时统计解压前后的大小
+type decodedBody struct {
+	io.Reader
+	encoding string
+	encoded  *countingReader
+	decoded  *countingReader
+}
+
+// decodeBody 按照 Content-Encoding 解压 body, 多个 encoding 时按相反的
+// 顺序解压. 没有 Content-Encoding 或者 body 为空时返回 nil, 不支持的
+// encoding 在读取 body 之前返回错误
+func decodeBody(header http.Header, body io.Reader) (*decodedBody, error) {
+	encodings := []string{}
+	for _, value := range header["Content-Encoding"] {
+		for _, e := range strings.Split(value, ",") {
+			if e = strings.ToLower(strings.TrimSpace(e)); e != "" && e != "identity" {
+				encodings = append(encodings, e)
+			}
+		}
+	}
+	if len(encodings) == 0 {
+		return nil, nil
+	}
+
+	for _, e := range encodings {
+		if _, ok := contentDecoders[e]; !ok {
+			return nil, unsupportedEncodingError(e)
+		}
+	}
+
+	d := &decodedBody{
+		encoding: strings.Join(encodings, ", "),
+		encoded:  &countingReader{r: body},
+	}
+	r := bufio.NewReader(d.encoded)
+	// HEAD 和 304 之类的响应没有 body
+	if _, err := r.Peek(1); err == io.EOF {
+		return nil, nil
+	}
+	var reader io.Reader = r
+	for i := len(encodings) - 1; i >= 0; i-- {
+		var err error
+		if reader, err = contentDecoders[encodings[i]](bufio.NewReader(reader)); err != nil {
+			return nil, fmt.Errorf("decode %s body: %s", encodings[i], err)
+		}
+	}
+	d.decoded = &countingReader{r: reader}
+	d.Reader = d.decoded
+	return d, nil
+}
+
+// String 用于 verbose 模式下显示解压前后的大小
+func (d *decodedBody) String() string {
+	return fmt.Sprintf("(%s body of %d bytes decoded to %d bytes)", d.encoding, d.encoded.n, d.decoded.n)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.n += int64(n)
+	return n, err
+}
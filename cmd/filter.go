@@ -0,0 +1,1381 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// filter 编译后的 --filter 表达式, 语法是 jq 的一个子集:
+//
+//	.  .a  .a.b  ."a b"  .[0]  .[-1]  .[1:3]  .[]  .a[]  ..
+//	a | b   a, b   [a]   {a: .b, c}   (a)   a?   a // b
+//	==  !=  <  <=  >  >=  and  or  not
+//	length  keys  has(k)  type  map(f)  select(f)  first  last
+//	sort  sort_by(f)  add  join(s)  tostring  tonumber  empty
+//
+// 也支持 JSONPath 风格的 `$`, `.*` 和 `[*]`.
+type filter struct {
+	expr string
+	root filterNode
+}
+
+// filterError 带有出错位置的错误, 输出时指出表达式中对应的位置
+type filterError struct {
+	expr string
+	pos  int
+	msg  string
+}
+
+func (e *filterError) Error() string {
+	col := utf8.RuneCountInString(e.expr[:e.pos])
+	return fmt.Sprintf("filter error at column %d: %s\n    %s\n    %s^",
+		col+1, e.msg, e.expr, strings.Repeat(" ", col))
+}
+
+// evalError 运行时的错误, pos 是出错的节点在表达式中的位置
+type evalError struct {
+	pos int
+	msg string
+}
+
+func (e *evalError) Error() string {
+	return e.msg
+}
+
+func evalErrorf(pos int, format string, a ...interface{}) error {
+	return &evalError{pos: pos, msg: fmt.Sprintf(format, a...)}
+}
+
+func compileFilter(expr string) (*filter, error) {
+	tokens, err := lexFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+	p := &filterParser{expr: expr, tokens: tokens}
+	root, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, p.errorf(t.pos, "unexpected %s", t)
+	}
+	return &filter{expr: expr, root: root}, nil
+}
+
+// run 对 JSON 格式的 data 求值, 返回所有的结果
+func (f *filter) run(data []byte) ([]interface{}, error) {
+	v, err := decodeJSON(data)
+	if err != nil {
+		return nil, fmt.Errorf("filter: the body is not JSON: %s", err)
+	}
+	results, err := f.root.eval(v)
+	if e, ok := err.(*evalError); ok {
+		return results, &filterError{expr: f.expr, pos: e.pos, msg: e.msg}
+	}
+	return results, err
+}
+
+// ---- lexer ----
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokPunct
+	tokIdent
+	tokNumber
+	tokString
+)
+
+type token struct {
+	kind tokenKind
+	text string
+	// 字符串的值
+	value string
+	pos   int
+	// 前面是否有空白, `.a` 和 `. a` 的含义不同
+	space bool
+}
+
+func (t token) String() string {
+	if t.kind == tokEOF {
+		return "end of expression"
+	}
+	return strconv.Quote(t.text)
+}
+
+func (t token) is(text string) bool {
+	return t.kind == tokPunct && t.text == text
+}
+
+// 长的符号在前
+var filterPuncts = []string{
+	"..", "==", "!=", "<=", ">=", "//",
+	".", "[", "]", "(", ")", "{", "}", "|", ",", ":", "?", "<", ">", "$", "*",
+}
+
+func lexFilter(expr string) (tokens []token, err error) {
+	space := false
+	for i := 0; i < len(expr); {
+		c := expr[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			space = true
+			i++
+			continue
+		case c == '"':
+			end := stringEnd(expr, i)
+			var s string
+			if e := json.Unmarshal([]byte(expr[i:end]), &s); e != nil {
+				return nil, &filterError{expr: expr, pos: i, msg: "invalid string literal"}
+			}
+			tokens = append(tokens, token{kind: tokString, text: expr[i:end], value: s, pos: i, space: space})
+			i = end
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(expr) && strings.IndexByte("0123456789.eE", expr[end]) >= 0 {
+				end++
+			}
+			if _, e := strconv.ParseFloat(expr[i:end], 64); e != nil {
+				return nil, &filterError{expr: expr, pos: i, msg: fmt.Sprintf("invalid number %q", expr[i:end])}
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: expr[i:end], pos: i, space: space})
+			i = end
+		case isIdentByte(c, false):
+			end := i + 1
+			for end < len(expr) && isIdentByte(expr[end], true) {
+				end++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: expr[i:end], pos: i, space: space})
+			i = end
+		default:
+			matched := false
+			for _, p := range filterPuncts {
+				if strings.HasPrefix(expr[i:], p) {
+					tokens = append(tokens, token{kind: tokPunct, text: p, pos: i, space: space})
+					i += len(p)
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				r, _ := utf8.DecodeRuneInString(expr[i:])
+				return nil, &filterError{expr: expr, pos: i, msg: fmt.Sprintf("unexpected character %q", r)}
+			}
+		}
+		space = false
+	}
+	tokens = append(tokens, token{kind: tokEOF, pos: len(expr)})
+	return
+}
+
+func isIdentByte(c byte, digit bool) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (digit && c >= '0' && c <= '9')
+}
+
+// ---- parser ----
+
+type filterParser struct {
+	expr   string
+	tokens []token
+	i      int
+}
+
+func (p *filterParser) peek() token {
+	return p.tokens[p.i]
+}
+
+func (p *filterParser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *filterParser) errorf(pos int, format string, a ...interface{}) error {
+	return &filterError{expr: p.expr, pos: pos, msg: fmt.Sprintf(format, a...)}
+}
+
+func (p *filterParser) expect(text string) error {
+	if t := p.next(); !t.is(text) {
+		return p.errorf(t.pos, "expected %q but got %s", text, t)
+	}
+	return nil
+}
+
+// pipe := comma ('|' comma)*
+func (p *filterParser) parsePipe() (filterNode, error) {
+	left, err := p.parseComma()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("|") {
+		p.next()
+		right, err := p.parseComma()
+		if err != nil {
+			return nil, err
+		}
+		left = &pipeNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+// comma := alternative (',' alternative)*
+func (p *filterParser) parseComma() (filterNode, error) {
+	left, err := p.parseAlternative()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is(",") {
+		p.next()
+		right, err := p.parseAlternative()
+		if err != nil {
+			return nil, err
+		}
+		left = &commaNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+// alternative := or ('//' or)*
+func (p *filterParser) parseAlternative() (filterNode, error) {
+	left, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().is("//") {
+		p.next()
+		right, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		left = &alternativeNode{left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseOr() (filterNode, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == tokIdent && t.text == "or"; t = p.peek() {
+		p.next()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{and: false, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseAnd() (filterNode, error) {
+	left, err := p.parseComparison()
+	if err != nil {
+		return nil, err
+	}
+	for t := p.peek(); t.kind == tokIdent && t.text == "and"; t = p.peek() {
+		p.next()
+		right, err := p.parseComparison()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicNode{and: true, left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *filterParser) parseComparison() (filterNode, error) {
+	left, err := p.parsePostfix()
+	if err != nil {
+		return nil, err
+	}
+	t := p.peek()
+	switch {
+	case t.is("=="), t.is("!="), t.is("<"), t.is("<="), t.is(">"), t.is(">="):
+		p.next()
+		right, err := p.parsePostfix()
+		if err != nil {
+			return nil, err
+		}
+		return &compareNode{op: t.text, left: left, right: right}, nil
+	}
+	return left, nil
+}
+
+// postfix := primary ('.' name | '[' ... ']' | '?')*
+func (p *filterParser) parsePostfix() (filterNode, error) {
+	node, err := p.parsePrimary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		t := p.peek()
+		switch {
+		case t.is(".") && !p.tokens[p.i+1].space && isFieldToken(p.tokens[p.i+1]):
+			p.next()
+			name := p.next()
+			node = &fieldNode{target: node, name: fieldName(name), pos: name.pos}
+		case t.is(".") && !p.tokens[p.i+1].space && p.tokens[p.i+1].is("*"):
+			p.next()
+			p.next()
+			node = &iterateNode{target: node, pos: t.pos}
+		case t.is(".") && !p.tokens[p.i+1].space && p.tokens[p.i+1].is("["):
+			// `.a.[0]` 等同于 `.a[0]`
+			p.next()
+		case t.is("[") && !t.space:
+			if node, err = p.parseBracket(node); err != nil {
+				return nil, err
+			}
+		case t.is("?"):
+			p.next()
+			node = &tryNode{body: node}
+		default:
+			return node, nil
+		}
+	}
+}
+
+func isFieldToken(t token) bool {
+	return t.kind == tokIdent || t.kind == tokString
+}
+
+func fieldName(t token) string {
+	if t.kind == tokString {
+		return t.value
+	}
+	return t.text
+}
+
+// parseBracket 解析 `[]`, `[*]`, `[i]` 和 `[i:j]`
+func (p *filterParser) parseBracket(target filterNode) (filterNode, error) {
+	open := p.next()
+	if p.peek().is("]") {
+		p.next()
+		return &iterateNode{target: target, pos: open.pos}, nil
+	}
+	if p.peek().is("*") && p.tokens[p.i+1].is("]") {
+		p.next()
+		p.next()
+		return &iterateNode{target: target, pos: open.pos}, nil
+	}
+
+	var from, to filterNode
+	var err error
+	if !p.peek().is(":") {
+		if from, err = p.parsePipe(); err != nil {
+			return nil, err
+		}
+	}
+	if !p.peek().is(":") {
+		if err = p.expect("]"); err != nil {
+			return nil, err
+		}
+		return &indexNode{target: target, index: from, pos: open.pos}, nil
+	}
+	p.next()
+	if !p.peek().is("]") {
+		if to, err = p.parsePipe(); err != nil {
+			return nil, err
+		}
+	}
+	if err = p.expect("]"); err != nil {
+		return nil, err
+	}
+	return &sliceNode{target: target, from: from, to: to, pos: open.pos}, nil
+}
+
+func (p *filterParser) parsePrimary() (filterNode, error) {
+	t := p.next()
+	switch t.kind {
+	case tokNumber:
+		return &literalNode{value: json.Number(t.text)}, nil
+	case tokString:
+		return &literalNode{value: t.value}, nil
+	case tokIdent:
+		switch t.text {
+		case "true":
+			return &literalNode{value: true}, nil
+		case "false":
+			return &literalNode{value: false}, nil
+		case "null":
+			return &literalNode{value: nil}, nil
+		}
+		return p.parseCall(t)
+	case tokEOF:
+		return nil, p.errorf(t.pos, "unexpected end of expression")
+	}
+
+	switch t.text {
+	case ".", "$":
+		next := p.peek()
+		if !next.space && isFieldToken(next) {
+			p.next()
+			return &fieldNode{target: identityNode{}, name: fieldName(next), pos: next.pos}, nil
+		}
+		return identityNode{}, nil
+	case "..":
+		return recurseNode{}, nil
+	case "(":
+		node, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect(")"); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case "[":
+		if p.peek().is("]") {
+			p.next()
+			return &arrayNode{}, nil
+		}
+		body, err := p.parsePipe()
+		if err != nil {
+			return nil, err
+		}
+		if err = p.expect("]"); err != nil {
+			return nil, err
+		}
+		return &arrayNode{body: body}, nil
+	case "{":
+		return p.parseObject()
+	}
+	return nil, p.errorf(t.pos, "unexpected %s", t)
+}
+
+// parseObject 解析 `{a: .b, "c": .d, (.k): .v, e}`, `{`已被读取
+func (p *filterParser) parseObject() (filterNode, error) {
+	node := &objectNode{}
+	for !p.peek().is("}") {
+		t := p.next()
+		var entry objectEntry
+		switch {
+		case isFieldToken(t):
+			entry.key = &literalNode{value: fieldName(t)}
+			// `{a}` 等同于 `{a: .a}`
+			entry.value = &fieldNode{target: identityNode{}, name: fieldName(t), pos: t.pos}
+		case t.is("("):
+			key, err := p.parsePipe()
+			if err != nil {
+				return nil, err
+			}
+			if err = p.expect(")"); err != nil {
+				return nil, err
+			}
+			entry.key = key
+			entry.pos = t.pos
+		default:
+			return nil, p.errorf(t.pos, "unexpected %s in object", t)
+		}
+		if p.peek().is(":") {
+			p.next()
+			value, err := p.parseAlternative()
+			if err != nil {
+				return nil, err
+			}
+			entry.value = value
+		} else if entry.value == nil {
+			return nil, p.errorf(p.peek().pos, "expected \":\" but got %s", p.peek())
+		}
+		node.entries = append(node.entries, entry)
+
+		if p.peek().is(",") {
+			p.next()
+		} else if !p.peek().is("}") {
+			return nil, p.errorf(p.peek().pos, "expected \",\" or \"}\" but got %s", p.peek())
+		}
+	}
+	p.next()
+	return node, nil
+}
+
+func (p *filterParser) parseCall(name token) (filterNode, error) {
+	f, ok := filterFuncs[name.text]
+	if !ok {
+		return nil, p.errorf(name.pos, "unknown function %q", name.text)
+	}
+	node := &callNode{name: name.text, fn: f.fn, pos: name.pos}
+	if f.args == 0 {
+		return node, nil
+	}
+	if err := p.expect("("); err != nil {
+		return nil, err
+	}
+	arg, err := p.parsePipe()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.expect(")"); err != nil {
+		return nil, err
+	}
+	node.arg = arg
+	return node, nil
+}
+
+// ---- evaluation ----
+
+type filterNode interface {
+	eval(v interface{}) ([]interface{}, error)
+}
+
+type identityNode struct{}
+
+func (identityNode) eval(v interface{}) ([]interface{}, error) {
+	return []interface{}{v}, nil
+}
+
+// recurseNode `..` 依次输出自身以及所有子孙节点
+type recurseNode struct{}
+
+func (recurseNode) eval(v interface{}) ([]interface{}, error) {
+	results := []interface{}{v}
+	for _, child := range children(v) {
+		sub, _ := recurseNode{}.eval(child)
+		results = append(results, sub...)
+	}
+	return results, nil
+}
+
+type literalNode struct {
+	value interface{}
+}
+
+func (n *literalNode) eval(v interface{}) ([]interface{}, error) {
+	return []interface{}{n.value}, nil
+}
+
+type fieldNode struct {
+	target filterNode
+	name   string
+	pos    int
+}
+
+func (n *fieldNode) eval(v interface{}) ([]interface{}, error) {
+	targets, err := n.target.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	results := []interface{}{}
+	for _, t := range targets {
+		switch t := t.(type) {
+		case nil:
+			results = append(results, nil)
+		case map[string]interface{}:
+			results = append(results, t[n.name])
+		default:
+			return nil, evalErrorf(n.pos, "cannot get field %q of %s", n.name, jsonTypeName(t))
+		}
+	}
+	return results, nil
+}
+
+type indexNode struct {
+	target filterNode
+	index  filterNode
+	pos    int
+}
+
+func (n *indexNode) eval(v interface{}) ([]interface{}, error) {
+	targets, err := n.target.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	// 和 jq 一样, 下标表达式以整个输入为参数求值: `.[.i]`
+	indexes, err := n.index.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	results := []interface{}{}
+	for _, t := range targets {
+		for _, index := range indexes {
+			r, err := indexValue(t, index, n.pos)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, r)
+		}
+	}
+	return results, nil
+}
+
+func indexValue(t, index interface{}, pos int) (interface{}, error) {
+	switch t := t.(type) {
+	case nil:
+		return nil, nil
+	case map[string]interface{}:
+		if key, ok := index.(string); ok {
+			return t[key], nil
+		}
+	case []interface{}:
+		if f, ok := toFloat(index); ok {
+			i := int(math.Floor(f))
+			if i < 0 {
+				i += len(t)
+			}
+			if i < 0 || i >= len(t) {
+				return nil, nil
+			}
+			return t[i], nil
+		}
+	}
+	return nil, evalErrorf(pos, "cannot index %s with %s", jsonTypeName(t), jsonTypeName(index))
+}
+
+type sliceNode struct {
+	target   filterNode
+	from, to filterNode
+	pos      int
+}
+
+func (n *sliceNode) eval(v interface{}) ([]interface{}, error) {
+	targets, err := n.target.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	bound := func(node filterNode, length, def int) (int, error) {
+		if node == nil {
+			return def, nil
+		}
+		values, err := node.eval(v)
+		if err != nil {
+			return 0, err
+		}
+		if len(values) != 1 {
+			return 0, evalErrorf(n.pos, "slice bound must be a single number")
+		}
+		if values[0] == nil {
+			return def, nil
+		}
+		f, ok := toFloat(values[0])
+		if !ok {
+			return 0, evalErrorf(n.pos, "slice bound must be a number, not %s", jsonTypeName(values[0]))
+		}
+		i := int(math.Floor(f))
+		if i < 0 {
+			i += length
+		}
+		if i < 0 {
+			i = 0
+		}
+		if i > length {
+			i = length
+		}
+		return i, nil
+	}
+
+	results := []interface{}{}
+	for _, t := range targets {
+		var length int
+		switch t := t.(type) {
+		case nil:
+			results = append(results, nil)
+			continue
+		case []interface{}:
+			length = len(t)
+		case string:
+			length = utf8.RuneCountInString(t)
+		default:
+			return nil, evalErrorf(n.pos, "cannot slice %s", jsonTypeName(t))
+		}
+		from, err := bound(n.from, length, 0)
+		if err != nil {
+			return nil, err
+		}
+		to, err := bound(n.to, length, length)
+		if err != nil {
+			return nil, err
+		}
+		if to < from {
+			to = from
+		}
+		if s, ok := t.(string); ok {
+			results = append(results, string([]rune(s)[from:to]))
+		} else {
+			results = append(results, t.([]interface{})[from:to])
+		}
+	}
+	return results, nil
+}
+
+type iterateNode struct {
+	target filterNode
+	pos    int
+}
+
+func (n *iterateNode) eval(v interface{}) ([]interface{}, error) {
+	targets, err := n.target.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	results := []interface{}{}
+	for _, t := range targets {
+		switch t.(type) {
+		case []interface{}, map[string]interface{}:
+			results = append(results, children(t)...)
+		default:
+			return nil, evalErrorf(n.pos, "cannot iterate over %s", jsonTypeName(t))
+		}
+	}
+	return results, nil
+}
+
+// tryNode `a?` 忽略 a 的错误
+type tryNode struct {
+	body filterNode
+}
+
+func (n *tryNode) eval(v interface{}) ([]interface{}, error) {
+	results, err := n.body.eval(v)
+	if err != nil {
+		return []interface{}{}, nil
+	}
+	return results, nil
+}
+
+type pipeNode struct {
+	left, right filterNode
+}
+
+func (n *pipeNode) eval(v interface{}) ([]interface{}, error) {
+	lefts, err := n.left.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	results := []interface{}{}
+	for _, l := range lefts {
+		rights, err := n.right.eval(l)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, rights...)
+	}
+	return results, nil
+}
+
+type commaNode struct {
+	left, right filterNode
+}
+
+func (n *commaNode) eval(v interface{}) ([]interface{}, error) {
+	lefts, err := n.left.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	rights, err := n.right.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(lefts, rights...), nil
+}
+
+// alternativeNode `a // b`: a 中不是 false 和 null 的结果, 都没有时使用 b
+type alternativeNode struct {
+	left, right filterNode
+}
+
+func (n *alternativeNode) eval(v interface{}) ([]interface{}, error) {
+	lefts, _ := n.left.eval(v)
+	results := []interface{}{}
+	for _, l := range lefts {
+		if truthy(l) {
+			results = append(results, l)
+		}
+	}
+	if len(results) > 0 {
+		return results, nil
+	}
+	return n.right.eval(v)
+}
+
+type logicNode struct {
+	and         bool
+	left, right filterNode
+}
+
+func (n *logicNode) eval(v interface{}) ([]interface{}, error) {
+	lefts, err := n.left.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	results := []interface{}{}
+	for _, l := range lefts {
+		// 短路求值
+		if truthy(l) != n.and {
+			results = append(results, truthy(l))
+			continue
+		}
+		rights, err := n.right.eval(v)
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rights {
+			results = append(results, truthy(r))
+		}
+	}
+	return results, nil
+}
+
+type compareNode struct {
+	op          string
+	left, right filterNode
+}
+
+func (n *compareNode) eval(v interface{}) ([]interface{}, error) {
+	lefts, err := n.left.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	rights, err := n.right.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	results := []interface{}{}
+	for _, r := range rights {
+		for _, l := range lefts {
+			c := compareValues(l, r)
+			var b bool
+			switch n.op {
+			case "==":
+				b = c == 0
+			case "!=":
+				b = c != 0
+			case "<":
+				b = c < 0
+			case "<=":
+				b = c <= 0
+			case ">":
+				b = c > 0
+			case ">=":
+				b = c >= 0
+			}
+			results = append(results, b)
+		}
+	}
+	return results, nil
+}
+
+type arrayNode struct {
+	body filterNode
+}
+
+func (n *arrayNode) eval(v interface{}) ([]interface{}, error) {
+	if n.body == nil {
+		return []interface{}{[]interface{}{}}, nil
+	}
+	values, err := n.body.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	return []interface{}{values}, nil
+}
+
+type objectEntry struct {
+	key, value filterNode
+	pos        int
+}
+
+type objectNode struct {
+	entries []objectEntry
+}
+
+// eval 每个 key 或 value 有多个结果时生成所有的组合, 与 jq 相同
+func (n *objectNode) eval(v interface{}) ([]interface{}, error) {
+	objects := []map[string]interface{}{{}}
+	for _, entry := range n.entries {
+		keys, err := entry.key.eval(v)
+		if err != nil {
+			return nil, err
+		}
+		values, err := entry.value.eval(v)
+		if err != nil {
+			return nil, err
+		}
+		next := []map[string]interface{}{}
+		for _, obj := range objects {
+			for _, k := range keys {
+				key, ok := k.(string)
+				if !ok {
+					return nil, evalErrorf(entry.pos, "object key must be a string, not %s", jsonTypeName(k))
+				}
+				for _, value := range values {
+					o := make(map[string]interface{}, len(obj)+1)
+					for kk, vv := range obj {
+						o[kk] = vv
+					}
+					o[key] = value
+					next = append(next, o)
+				}
+			}
+		}
+		objects = next
+	}
+	results := make([]interface{}, len(objects))
+	for i, obj := range objects {
+		results[i] = obj
+	}
+	return results, nil
+}
+
+type callNode struct {
+	name string
+	fn   func(n *callNode, v interface{}) ([]interface{}, error)
+	arg  filterNode
+	pos  int
+}
+
+func (n *callNode) eval(v interface{}) ([]interface{}, error) {
+	return n.fn(n, v)
+}
+
+// ---- functions ----
+
+type filterFunc struct {
+	args int
+	fn   func(n *callNode, v interface{}) ([]interface{}, error)
+}
+
+var filterFuncs map[string]filterFunc
+
+func init() {
+	filterFuncs = map[string]filterFunc{
+		"length":   {0, fnLength},
+		"keys":     {0, fnKeys},
+		"has":      {1, fnHas},
+		"type":     {0, fnType},
+		"not":      {0, fnNot},
+		"map":      {1, fnMap},
+		"select":   {1, fnSelect},
+		"first":    {0, fnFirst},
+		"last":     {0, fnLast},
+		"sort":     {0, fnSort},
+		"sort_by":  {1, fnSortBy},
+		"add":      {0, fnAdd},
+		"join":     {1, fnJoin},
+		"tostring": {0, fnToString},
+		"tonumber": {0, fnToNumber},
+		"empty":    {0, fnEmpty},
+	}
+}
+
+func single(v interface{}) []interface{} {
+	return []interface{}{v}
+}
+
+func number(f float64) json.Number {
+	return json.Number(strconv.FormatFloat(f, 'f', -1, 64))
+}
+
+func fnLength(n *callNode, v interface{}) ([]interface{}, error) {
+	switch v := v.(type) {
+	case nil:
+		return single(json.Number("0")), nil
+	case string:
+		return single(number(float64(utf8.RuneCountInString(v)))), nil
+	case []interface{}:
+		return single(number(float64(len(v)))), nil
+	case map[string]interface{}:
+		return single(number(float64(len(v)))), nil
+	case json.Number:
+		f, _ := v.Float64()
+		return single(number(math.Abs(f))), nil
+	}
+	return nil, evalErrorf(n.pos, "%s has no length", jsonTypeName(v))
+}
+
+func fnKeys(n *callNode, v interface{}) ([]interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		keys := []interface{}{}
+		for _, k := range sortedMapKeys(v) {
+			keys = append(keys, k)
+		}
+		return single(keys), nil
+	case []interface{}:
+		keys := make([]interface{}, len(v))
+		for i := range v {
+			keys[i] = number(float64(i))
+		}
+		return single(keys), nil
+	}
+	return nil, evalErrorf(n.pos, "%s has no keys", jsonTypeName(v))
+}
+
+func fnHas(n *callNode, v interface{}) ([]interface{}, error) {
+	keys, err := n.arg.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	results := []interface{}{}
+	for _, key := range keys {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			k, ok := key.(string)
+			if !ok {
+				return nil, evalErrorf(n.pos, "cannot check whether object has a key of type %s", jsonTypeName(key))
+			}
+			_, has := v[k]
+			results = append(results, has)
+		case []interface{}:
+			f, ok := toFloat(key)
+			if !ok {
+				return nil, evalErrorf(n.pos, "cannot check whether array has a key of type %s", jsonTypeName(key))
+			}
+			results = append(results, f >= 0 && int(f) < len(v))
+		default:
+			return nil, evalErrorf(n.pos, "cannot check whether %s has a key", jsonTypeName(v))
+		}
+	}
+	return results, nil
+}
+
+func fnType(n *callNode, v interface{}) ([]interface{}, error) {
+	return single(jsonTypeName(v)), nil
+}
+
+func fnNot(n *callNode, v interface{}) ([]interface{}, error) {
+	return single(!truthy(v)), nil
+}
+
+func fnMap(n *callNode, v interface{}) ([]interface{}, error) {
+	switch v.(type) {
+	case []interface{}, map[string]interface{}:
+	default:
+		return nil, evalErrorf(n.pos, "cannot iterate over %s", jsonTypeName(v))
+	}
+	results := []interface{}{}
+	for _, child := range children(v) {
+		values, err := n.arg.eval(child)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, values...)
+	}
+	return single(results), nil
+}
+
+func fnSelect(n *callNode, v interface{}) ([]interface{}, error) {
+	conditions, err := n.arg.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	results := []interface{}{}
+	for _, c := range conditions {
+		if truthy(c) {
+			results = append(results, v)
+		}
+	}
+	return results, nil
+}
+
+func fnFirst(n *callNode, v interface{}) ([]interface{}, error) {
+	r, err := indexValue(v, json.Number("0"), n.pos)
+	return single(r), err
+}
+
+func fnLast(n *callNode, v interface{}) ([]interface{}, error) {
+	r, err := indexValue(v, json.Number("-1"), n.pos)
+	return single(r), err
+}
+
+func fnSort(n *callNode, v interface{}) ([]interface{}, error) {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, evalErrorf(n.pos, "cannot sort %s", jsonTypeName(v))
+	}
+	sorted := append([]interface{}{}, arr...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return compareValues(sorted[i], sorted[j]) < 0
+	})
+	return single(sorted), nil
+}
+
+func fnSortBy(n *callNode, v interface{}) ([]interface{}, error) {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, evalErrorf(n.pos, "cannot sort %s", jsonTypeName(v))
+	}
+	keys := make([]interface{}, len(arr))
+	for i, item := range arr {
+		values, err := n.arg.eval(item)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = values
+	}
+	index := make([]int, len(arr))
+	for i := range index {
+		index[i] = i
+	}
+	sort.SliceStable(index, func(i, j int) bool {
+		return compareValues(keys[index[i]], keys[index[j]]) < 0
+	})
+	sorted := make([]interface{}, len(arr))
+	for i, j := range index {
+		sorted[i] = arr[j]
+	}
+	return single(sorted), nil
+}
+
+// fnAdd 数字相加, 字符串和数组连接, 对象合并
+func fnAdd(n *callNode, v interface{}) ([]interface{}, error) {
+	var items []interface{}
+	switch v := v.(type) {
+	case []interface{}:
+		items = v
+	case map[string]interface{}:
+		items = children(v)
+	default:
+		return nil, evalErrorf(n.pos, "cannot add the elements of %s", jsonTypeName(v))
+	}
+	var sum interface{}
+	for _, item := range items {
+		if item == nil {
+			continue
+		}
+		if sum == nil {
+			sum = item
+			continue
+		}
+		switch s := sum.(type) {
+		case json.Number:
+			b, ok := item.(json.Number)
+			if !ok {
+				return nil, evalErrorf(n.pos, "cannot add number and %s", jsonTypeName(item))
+			}
+			sum = addNumbers(s, b)
+		case string:
+			b, ok := item.(string)
+			if !ok {
+				return nil, evalErrorf(n.pos, "cannot add string and %s", jsonTypeName(item))
+			}
+			sum = s + b
+		case []interface{}:
+			b, ok := item.([]interface{})
+			if !ok {
+				return nil, evalErrorf(n.pos, "cannot add array and %s", jsonTypeName(item))
+			}
+			sum = append(append([]interface{}{}, s...), b...)
+		case map[string]interface{}:
+			b, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, evalErrorf(n.pos, "cannot add object and %s", jsonTypeName(item))
+			}
+			merged := map[string]interface{}{}
+			for k, v := range s {
+				merged[k] = v
+			}
+			for k, v := range b {
+				merged[k] = v
+			}
+			sum = merged
+		default:
+			return nil, evalErrorf(n.pos, "cannot add %s", jsonTypeName(sum))
+		}
+	}
+	return single(sum), nil
+}
+
+// addNumbers 两个整数用 big.Int 相加, 这样大于 2^53 的整数不会丢失精度,
+// 其他情况按浮点数相加
+func addNumbers(a, b json.Number) json.Number {
+	x, okA := new(big.Int).SetString(string(a), 10)
+	y, okB := new(big.Int).SetString(string(b), 10)
+	if okA && okB {
+		return json.Number(x.Add(x, y).String())
+	}
+	fa, _ := a.Float64()
+	fb, _ := b.Float64()
+	return number(fa + fb)
+}
+
+func fnJoin(n *callNode, v interface{}) ([]interface{}, error) {
+	arr, ok := v.([]interface{})
+	if !ok {
+		return nil, evalErrorf(n.pos, "cannot join %s", jsonTypeName(v))
+	}
+	seps, err := n.arg.eval(v)
+	if err != nil {
+		return nil, err
+	}
+	results := []interface{}{}
+	for _, sep := range seps {
+		s, ok := sep.(string)
+		if !ok {
+			return nil, evalErrorf(n.pos, "join separator must be a string, not %s", jsonTypeName(sep))
+		}
+		parts := make([]string, len(arr))
+		for i, item := range arr {
+			switch item := item.(type) {
+			case nil:
+			case string:
+				parts[i] = item
+			case json.Number, bool:
+				parts[i] = fmt.Sprint(item)
+			default:
+				return nil, evalErrorf(n.pos, "cannot join %s", jsonTypeName(item))
+			}
+		}
+		results = append(results, strings.Join(parts, s))
+	}
+	return results, nil
+}
+
+func fnToString(n *callNode, v interface{}) ([]interface{}, error) {
+	if s, ok := v.(string); ok {
+		return single(s), nil
+	}
+	b, err := json.Marshal(v)
+	return single(string(b)), err
+}
+
+func fnToNumber(n *callNode, v interface{}) ([]interface{}, error) {
+	switch v := v.(type) {
+	case json.Number:
+		return single(v), nil
+	case string:
+		if _, err := strconv.ParseFloat(v, 64); err == nil {
+			return single(json.Number(v)), nil
+		}
+		return nil, evalErrorf(n.pos, "cannot parse %q as a number", v)
+	}
+	return nil, evalErrorf(n.pos, "cannot convert %s to a number", jsonTypeName(v))
+}
+
+func fnEmpty(n *callNode, v interface{}) ([]interface{}, error) {
+	return []interface{}{}, nil
+}
+
+// ---- helpers ----
+
+// children 数组的元素或者对象的值, 对象按 key 排序
+func children(v interface{}) []interface{} {
+	switch v := v.(type) {
+	case []interface{}:
+		return v
+	case map[string]interface{}:
+		values := make([]interface{}, 0, len(v))
+		for _, k := range sortedMapKeys(v) {
+			values = append(values, v[k])
+		}
+		return values
+	}
+	return nil
+}
+
+func sortedMapKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func truthy(v interface{}) bool {
+	return v != nil && v != false
+}
+
+func toFloat(v interface{}) (float64, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return 0, false
+	}
+	f, err := n.Float64()
+	return f, err == nil
+}
+
+// 与 jq 相同的排序: null < false < true < 数字 < 字符串 < 数组 < 对象
+func typeOrder(v interface{}) int {
+	switch v := v.(type) {
+	case nil:
+		return 0
+	case bool:
+		if v {
+			return 2
+		}
+		return 1
+	case json.Number:
+		return 3
+	case string:
+		return 4
+	case []interface{}:
+		return 5
+	}
+	return 6
+}
+
+func compareValues(a, b interface{}) int {
+	if ta, tb := typeOrder(a), typeOrder(b); ta != tb {
+		return ta - tb
+	}
+	switch a := a.(type) {
+	case json.Number:
+		fa, _ := toFloat(a)
+		fb, _ := toFloat(b)
+		switch {
+		case fa < fb:
+			return -1
+		case fa > fb:
+			return 1
+		}
+	case string:
+		return strings.Compare(a, b.(string))
+	case []interface{}:
+		bb := b.([]interface{})
+		for i := 0; i < len(a) && i < len(bb); i++ {
+			if c := compareValues(a[i], bb[i]); c != 0 {
+				return c
+			}
+		}
+		return len(a) - len(bb)
+	case map[string]interface{}:
+		bm := b.(map[string]interface{})
+		ka, kb := sortedMapKeys(a), sortedMapKeys(bm)
+		if c := compareValues(stringsToValues(ka), stringsToValues(kb)); c != 0 {
+			return c
+		}
+		for _, k := range ka {
+			if c := compareValues(a[k], bm[k]); c != 0 {
+				return c
+			}
+		}
+	}
+	return 0
+}
+
+func stringsToValues(s []string) []interface{} {
+	values := make([]interface{}, len(s))
+	for i, v := range s {
+		values[i] = v
+	}
+	return values
+}
@@ -0,0 +1,258 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+const filterTestInput = `{
+	"name": "gdhttp",
+	"tags": ["cli", "http"],
+	"jobs": [
+		{"id": 1, "status": "done", "size": 30},
+		{"id": 2, "status": "running", "size": 10},
+		{"id": 3, "status": "done", "size": 20}
+	],
+	"owner": null,
+	"meta": {"b": 2, "a": 1}
+}`
+
+// runFilter 对 input 求值 expr, 每个结果编码成 JSON 后用空格连接
+func runFilter(expr, input string) (string, error) {
+	if input == "" {
+		input = filterTestInput
+	}
+	f, err := compileFilter(expr)
+	if err != nil {
+		return "", err
+	}
+	results, err := f.run([]byte(input))
+	if err != nil {
+		return "", err
+	}
+	out := make([]string, len(results))
+	for i, r := range results {
+		b, err := json.Marshal(r)
+		if err != nil {
+			return "", err
+		}
+		out[i] = string(b)
+	}
+	return strings.Join(out, " "), nil
+}
+
+type filterCase struct {
+	expr  string
+	input string // 为空时使用 filterTestInput
+	want  string
+}
+
+func testFilterCases(t *testing.T, cases []filterCase) {
+	for _, c := range cases {
+		got, err := runFilter(c.expr, c.input)
+		if err != nil {
+			t.Errorf("%s: %s", c.expr, err)
+			continue
+		}
+		if got != c.want {
+			t.Errorf("%s = %s, want %s", c.expr, got, c.want)
+		}
+	}
+}
+
+func TestFilterPaths(t *testing.T) {
+	testFilterCases(t, []filterCase{
+		{".", "1", "1"},
+		{".name", "", `"gdhttp"`},
+		{".meta.a", "", "1"},
+		{`."name"`, "", `"gdhttp"`},
+		{".missing", "", "null"},
+		{".owner.x", "", "null"},
+		{".tags[0]", "", `"cli"`},
+		{".tags[-1]", "", `"http"`},
+		{".tags[5]", "", "null"},
+		{".tags[:1]", "", `["cli"]`},
+		{".jobs[1:] | length", "", "2"},
+		{".name[1:3]", "", `"dh"`},
+		{".[1:3]", `"名字abc"`, `"字a"`},
+		{".tags[]", "", `"cli" "http"`},
+		{".meta[]", "", "1 2"},
+		{".jobs[].id", "", "1 2 3"},
+		{".jobs.[0].id", "", "1"},
+		{"$.jobs[*].id", "", "1 2 3"},
+		{".meta.*", "", "1 2"},
+		{"..", "[1,[2]]", "[1,[2]] 1 [2] 2"},
+		{".tags | .[0], .[1]", "", `"cli" "http"`},
+		{"[.jobs[].id]", "", "[1,2,3]"},
+		{"[]", "", "[]"},
+		{"{name, n: (.jobs | length)}", "", `{"n":3,"name":"gdhttp"}`},
+		{"{(.name): 1}", "", `{"gdhttp":1}`},
+		{".name.x?", "", ""},
+		{`.name.x? // "d"`, "", `"d"`},
+		{`.owner // "nobody"`, "", `"nobody"`},
+		{`.name // "x"`, "", `"gdhttp"`},
+	})
+}
+
+func TestFilterOperators(t *testing.T) {
+	testFilterCases(t, []filterCase{
+		{".meta.a == 1", "", "true"},
+		{".meta.a != 1", "", "false"},
+		{".meta.a < .meta.b", "", "true"},
+		{`.name <= "a"`, "", "false"},
+		// 不同类型按 null < false < true < 数字 < 字符串 < 数组 < 对象 比较
+		{"1 > null", "", "true"},
+		{`"a" >= 1`, "", "true"},
+		{"[1,2] == [1,2]", "", "true"},
+		{`{"a": 1} == {"a": 1}`, "", "true"},
+		{"true and false", "", "false"},
+		{"false or true", "", "true"},
+		{"null or false", "", "false"},
+		{`"aé"`, "", `"aé"`},
+		{"-1.5", "", "-1.5"},
+		{"null", "", "null"},
+	})
+}
+
+func TestFilterFunctions(t *testing.T) {
+	testFilterCases(t, []filterCase{
+		{"length", "null", "0"},
+		{"length", `"名字"`, "2"},
+		{".tags | length", "", "2"},
+		{".meta | length", "", "2"},
+		{"-3 | length", "", "3"},
+		{".meta | keys", "", `["a","b"]`},
+		{".tags | keys", "", "[0,1]"},
+		{`.meta | has("a")`, "", "true"},
+		{`.meta | has("z")`, "", "false"},
+		{".tags | has(1)", "", "true"},
+		{".tags | has(2)", "", "false"},
+		{".name, .owner, .tags, .meta, .meta.a, true | type", "",
+			`"string" "null" "array" "object" "number" "boolean"`},
+		{"true | not", "", "false"},
+		{".owner | not", "", "true"},
+		{".jobs | map(.id)", "", "[1,2,3]"},
+		{".meta | map(tostring)", "", `["1","2"]`},
+		{`.jobs[] | select(.status == "done") | .id`, "", "1 3"},
+		{".tags | first", "", `"cli"`},
+		{".tags | last", "", `"http"`},
+		{"[] | first", "", "null"},
+		{`[3, 1, "a", null, true, false] | sort`, "", `[null,false,true,1,3,"a"]`},
+		{".jobs | sort_by(.size) | map(.id)", "", "[2,3,1]"},
+		{"[1, 2, 3] | add", "", "6"},
+		{`["a", "b"] | add`, "", `"ab"`},
+		{"[[1], [2]] | add", "", "[1,2]"},
+		{`[{"a": 1}, {"b": 2}] | add`, "", `{"a":1,"b":2}`},
+		{"[null, 1] | add", "", "1"},
+		{"[] | add", "", "null"},
+		{".meta | add", "", "3"},
+		{"[1.5, 2] | add", "", "3.5"},
+		{`.tags | join(", ")`, "", `"cli, http"`},
+		{`[1, null, true, "a"] | join("-")`, "", `"1--true-a"`},
+		{".meta | tostring", "", `"{\"a\":1,\"b\":2}"`},
+		{`"x" | tostring`, "", `"x"`},
+		{"1 | tostring", "", `"1"`},
+		{`"12" | tonumber`, "", "12"},
+		{"1.5 | tonumber", "", "1.5"},
+		{"empty", "", ""},
+	})
+}
+
+func TestFilterAddPrecision(t *testing.T) {
+	testFilterCases(t, []filterCase{
+		// 大于 2^53 的整数用 big.Int 相加
+		{"add", "[9007199254740993, 2]", "9007199254740995"},
+		{"[9007199254740993, 1] | add", "", "9007199254740994"},
+		{"add", "[123456789012345678901234567890, -1]", "123456789012345678901234567889"},
+		// 有一个不是整数时按浮点数相加
+		{"add", "[1, 0.5]", "1.5"},
+		{"add", "[1e2, 1]", "101"},
+	})
+}
+
+func TestFilterMultipleResults(t *testing.T) {
+	const input = `{"a": [1, 2, 3]}`
+	testFilterCases(t, []filterCase{
+		// select 对条件的每个为真的结果输出一次输入
+		{"select(.a[] > 1) | .a | length", input, "3 3"},
+		{"select(.a[] > 5)", input, ""},
+		{"select(empty)", input, ""},
+		{".a | map(., .)", input, "[1,1,2,2,3,3]"},
+		{".a | map(empty)", input, "[]"},
+		{".a | map(select(. != 2))", input, "[1,3]"},
+		{"[.a[] | select(. > 5)]", input, "[]"},
+		{"[.a[] | empty]", input, "[]"},
+		{"1, empty, 2", input, "1 2"},
+		{"{x: (1, 2)}", input, `{"x":1} {"x":2}`},
+		{"(1, 2) == (1, 2)", input, "true false false true"},
+		{"empty // 3", input, "3"},
+		{"(null, 1, false, 2) // 3", input, "1 2"},
+		{`has("a", "z")`, input, "true false"},
+		{`["a", "b"] | join(",", "-")`, input, `"a,b" "a-b"`},
+	})
+}
+
+func TestFilterErrors(t *testing.T) {
+	cases := []struct {
+		expr  string
+		input string
+		want  string
+	}{
+		// 编译时的错误
+		{".x | foo", "", "filter error at column 6: unknown function \"foo\"\n    .x | foo\n         ^"},
+		{".a |", "", "filter error at column 5: unexpected end of expression\n    .a |\n        ^"},
+		{"(.a", "", "filter error at column 4: expected \")\" but got end of expression\n    (.a\n       ^"},
+		{".a # b", "", "filter error at column 4: unexpected character '#'\n    .a # b\n       ^"},
+		{`"abc`, "", "filter error at column 1: invalid string literal\n    \"abc\n    ^"},
+		{"1.2.3", "", "filter error at column 1: invalid number \"1.2.3\"\n    1.2.3\n    ^"},
+		{"{a: 1 b}", "", "filter error at column 7: expected \",\" or \"}\" but got \"b\"\n    {a: 1 b}\n          ^"},
+		{"{1: 2}", "", "filter error at column 2: unexpected \"1\" in object\n    {1: 2}\n     ^"},
+		{"has", "", "filter error at column 4: expected \"(\" but got end of expression\n    has\n       ^"},
+		{".a )", "", "filter error at column 4: unexpected \")\"\n    .a )\n       ^"},
+		// 求值时的错误指向出错的节点
+		{".name.x", "", "filter error at column 7: cannot get field \"x\" of string\n    .name.x\n          ^"},
+		{".tags[] | .[]", "", "filter error at column 12: cannot iterate over string\n    .tags[] | .[]\n               ^"},
+		{`.tags["a"]`, "", "filter error at column 6: cannot index array with string\n    .tags[\"a\"]\n         ^"},
+		{`[1, "a"] | add`, "", "filter error at column 12: cannot add number and string\n    [1, \"a\"] | add\n               ^"},
+		{`"abc" | tonumber`, "", "filter error at column 9: cannot parse \"abc\" as a number\n    \"abc\" | tonumber\n            ^"},
+		{".name | keys", "", "filter error at column 9: string has no keys\n    .name | keys\n            ^"},
+		// 列号按字符计算
+		{`."名字".x`, `{"名字": 1}`, "filter error at column 7: cannot get field \"x\" of number\n    .\"名字\".x\n          ^"},
+	}
+	for _, c := range cases {
+		_, err := runFilter(c.expr, c.input)
+		if err == nil {
+			t.Errorf("%s: expected an error", c.expr)
+			continue
+		}
+		if err.Error() != c.want {
+			t.Errorf("%s: error = %q, want %q", c.expr, err, c.want)
+		}
+	}
+
+	if _, err := runFilter(".", "not json"); err == nil ||
+		!strings.HasPrefix(err.Error(), "filter: the body is not JSON: ") {
+		t.Errorf("error for a body which is not JSON = %v", err)
+	}
+}
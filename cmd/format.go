@@ -0,0 +1,314 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"gopkg.in/yaml.v2"
+)
+
+const defaultOutputFormat = "json"
+
+// Formatter 输出 JSON 格式的 response body, 不是 JSON 的 body 不会传给 Formatter
+type Formatter interface {
+	Format(w io.Writer, data []byte) error
+}
+
+// outputFormatters --output-format 支持的格式, 新的格式在这里注册
+var outputFormatters = map[string]func(dump *DumpConfig) Formatter{
+	"json": func(dump *DumpConfig) Formatter {
+		return jsonFormatter{dump}
+	},
+	"compact": func(dump *DumpConfig) Formatter {
+		return compactFormatter{}
+	},
+	"raw": func(dump *DumpConfig) Formatter {
+		return rawFormatter{}
+	},
+	"yaml": func(dump *DumpConfig) Formatter {
+		return yamlFormatter{}
+	},
+	"table": func(dump *DumpConfig) Formatter {
+		return tableFormatter{columns: dump.columns}
+	},
+	"csv": func(dump *DumpConfig) Formatter {
+		return csvFormatter{columns: dump.columns}
+	},
+}
+
+func outputFormatNames() []string {
+	names := make([]string, 0, len(outputFormatters))
+	for name := range outputFormatters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func newFormatter(name string, dump *DumpConfig) (Formatter, error) {
+	factory, ok := outputFormatters[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown --output-format %q, must be one of %s",
+			name, strings.Join(outputFormatNames(), ", "))
+	}
+	return factory(dump), nil
+}
+
+// jsonFormatter 按照 --pretty 缩进和着色
+type jsonFormatter struct {
+	dump *DumpConfig
+}
+
+func (f jsonFormatter) Format(w io.Writer, data []byte) error {
+	_, err := fmt.Fprintln(w, f.dump.formatBody(data))
+	return err
+}
+
+type compactFormatter struct{}
+
+func (compactFormatter) Format(w io.Writer, data []byte) error {
+	var buf bytes.Buffer
+	if err := json.Compact(&buf, data); err != nil {
+		return err
+	}
+	buf.WriteByte('\n')
+	_, err := buf.WriteTo(w)
+	return err
+}
+
+// rawFormatter 原样输出, JSON 字符串输出不带引号的内容
+type rawFormatter struct{}
+
+func (rawFormatter) Format(w io.Writer, data []byte) error {
+	var s string
+	if json.Unmarshal(data, &s) == nil {
+		_, err := fmt.Fprintln(w, s)
+		return err
+	}
+	_, err := w.Write(data)
+	if err == nil && !bytes.HasSuffix(data, []byte("\n")) {
+		_, err = w.Write([]byte("\n"))
+	}
+	return err
+}
+
+type yamlFormatter struct{}
+
+func (yamlFormatter) Format(w io.Writer, data []byte) error {
+	v, err := decodeJSON(data)
+	if err != nil {
+		return err
+	}
+	b, err := yaml.Marshal(yamlValue(v))
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// yamlValue 把 json.Number 转换成数字, 否则会被当成字符串加上引号
+func yamlValue(v interface{}) interface{} {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := v.Int64(); err == nil {
+			return i
+		}
+		if u, err := strconv.ParseUint(string(v), 10, 64); err == nil {
+			return u
+		}
+		if f, err := v.Float64(); err == nil {
+			return f
+		}
+		return string(v)
+	case []interface{}:
+		for i := range v {
+			v[i] = yamlValue(v[i])
+		}
+	case map[string]interface{}:
+		for k := range v {
+			v[k] = yamlValue(v[k])
+		}
+	}
+	return v
+}
+
+// tableFormatter 把对象数组输出成对齐的列
+type tableFormatter struct {
+	columns []string
+}
+
+func (f tableFormatter) Format(w io.Writer, data []byte) error {
+	header, rows, err := tableRows(data, f.columns)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	escape := strings.NewReplacer("\t", `\t`, "\n", `\n`, "\r", `\r`)
+	for _, row := range append([][]string{header}, rows...) {
+		for i := range row {
+			row[i] = escape.Replace(row[i])
+		}
+		fmt.Fprintln(tw, strings.Join(row, "\t"))
+	}
+	return tw.Flush()
+}
+
+// csvFormatter 输出 RFC 4180 格式的 CSV, 第一行是列名
+type csvFormatter struct {
+	columns []string
+}
+
+func (f csvFormatter) Format(w io.Writer, data []byte) error {
+	header, rows, err := tableRows(data, f.columns)
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(w)
+	cw.UseCRLF = true
+	if err = cw.Write(header); err != nil {
+		return err
+	}
+	if err = cw.WriteAll(rows); err != nil {
+		return err
+	}
+	return cw.Error()
+}
+
+// tableRows 把 JSON 转换成表格: 对象数组中每个对象是一行, 列是所有对象的 key,
+// 按第一次出现的顺序排列; 单个对象是一行; 其他值的数组每个元素一行, 列名是 value,
+// 单个的其他值也是一行.
+// columns 不为空时只输出这些列.
+func tableRows(data []byte, columns []string) (header []string, rows [][]string, err error) {
+	var items []json.RawMessage
+	switch firstByte(data) {
+	case '[':
+		if err = json.Unmarshal(data, &items); err != nil {
+			return
+		}
+	case '{':
+		items = []json.RawMessage{data}
+	default:
+		return []string{"value"}, [][]string{{cellText(data)}}, nil
+	}
+
+	objects := make([]map[string]json.RawMessage, len(items))
+	seen := map[string]bool{}
+	allObjects := true
+	for i, item := range items {
+		if firstByte(item) != '{' {
+			allObjects = false
+			break
+		}
+		if err = json.Unmarshal(item, &objects[i]); err != nil {
+			return
+		}
+		keys, e := objectKeys(item)
+		if e != nil {
+			return nil, nil, e
+		}
+		for _, k := range keys {
+			if !seen[k] {
+				seen[k] = true
+				header = append(header, k)
+			}
+		}
+	}
+
+	if !allObjects {
+		header = []string{"value"}
+		for _, item := range items {
+			rows = append(rows, []string{cellText(item)})
+		}
+		return
+	}
+	if len(columns) > 0 {
+		header = columns
+	}
+	for _, obj := range objects {
+		row := make([]string, len(header))
+		for i, k := range header {
+			row[i] = cellText(obj[k])
+		}
+		rows = append(rows, row)
+	}
+	return
+}
+
+// objectKeys 按出现的顺序返回 JSON 对象的 key
+func objectKeys(data []byte) (keys []string, err error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	if _, err = d.Token(); err != nil {
+		return
+	}
+	for d.More() {
+		t, err := d.Token()
+		if err != nil {
+			return nil, err
+		}
+		var value json.RawMessage
+		if err = d.Decode(&value); err != nil {
+			return nil, err
+		}
+		keys = append(keys, t.(string))
+	}
+	return
+}
+
+// cellText 字符串不带引号, null 和不存在的值为空, 其他值使用紧凑的 JSON
+func cellText(raw json.RawMessage) string {
+	if len(raw) == 0 || string(raw) == "null" {
+		return ""
+	}
+	var s string
+	if json.Unmarshal(raw, &s) == nil {
+		return s
+	}
+	var buf bytes.Buffer
+	if json.Compact(&buf, raw) != nil {
+		return string(raw)
+	}
+	return buf.String()
+}
+
+func firstByte(data []byte) byte {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 {
+		return 0
+	}
+	return data[0]
+}
+
+func decodeJSON(data []byte) (v interface{}, err error) {
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	err = d.Decode(&v)
+	return
+}
@@ -0,0 +1,239 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 数组下标的上限, 防止 `a[100000000]=x` 生成巨大的数组
+const maxItemIndex = 1 << 16
+
+// pathSegment request item 的 key 中的一段路径
+type pathSegment struct {
+	key     string
+	isIndex bool
+	// 为 -1 时表示追加到数组末尾: `tags[]=x`
+	index int
+}
+
+func (seg pathSegment) String() string {
+	if !seg.isIndex {
+		return "[" + seg.key + "]"
+	}
+	if seg.index < 0 {
+		return "[]"
+	}
+	return "[" + strconv.Itoa(seg.index) + "]"
+}
+
+// parseItemPath 解析 `a[b][0]`, `a.b`, `tags[]` 这样的路径, `\` 用于转义 `.`, `[` 和 `]`
+func parseItemPath(rawKey string) (path []pathSegment, err error) {
+	var buf bytes.Buffer
+	// 当前这一段是否已经结束, 比如 `a[b]` 中 `]` 之后
+	closed := false
+
+	flush := func() error {
+		if closed {
+			if buf.Len() > 0 {
+				return fmt.Errorf("invalid path %q: unexpected %q after ']'", rawKey, buf.String())
+			}
+			return nil
+		}
+		if buf.Len() == 0 {
+			return fmt.Errorf("invalid path %q: empty name", rawKey)
+		}
+		path = append(path, pathSegment{key: buf.String()})
+		buf.Reset()
+		return nil
+	}
+
+	for i := 0; i < len(rawKey); i++ {
+		c := rawKey[i]
+		switch {
+		case c == itemEscape && i+1 < len(rawKey):
+			i++
+			buf.WriteByte(rawKey[i])
+		case c == '.':
+			if err = flush(); err != nil {
+				return
+			}
+			closed = false
+		case c == '[':
+			if len(path) > 0 || buf.Len() > 0 || closed {
+				if err = flush(); err != nil {
+					return
+				}
+			}
+			end := closingBracket(rawKey, i+1)
+			if end < 0 {
+				return nil, fmt.Errorf("invalid path %q: missing ']'", rawKey)
+			}
+			path = append(path, bracketSegment(unescapeItemPath(rawKey[i+1:end])))
+			i = end
+			closed = true
+		case c == ']':
+			return nil, fmt.Errorf("invalid path %q: unexpected ']'", rawKey)
+		default:
+			if closed {
+				return nil, fmt.Errorf("invalid path %q: unexpected %q after ']'", rawKey, c)
+			}
+			buf.WriteByte(c)
+		}
+	}
+	if err = flush(); err != nil {
+		return
+	}
+	if path[0].isIndex {
+		return nil, fmt.Errorf("invalid path %q: the JSON body must be an object", rawKey)
+	}
+	return
+}
+
+func closingBracket(s string, start int) int {
+	for i := start; i < len(s); i++ {
+		switch s[i] {
+		case itemEscape:
+			i++
+		case ']':
+			return i
+		}
+	}
+	return -1
+}
+
+func unescapeItemPath(s string) string {
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] == itemEscape && i+1 < len(s) {
+			i++
+		}
+		buf.WriteByte(s[i])
+	}
+	return buf.String()
+}
+
+// bracketSegment `[]` 表示追加, `[数字]` 表示下标, 其他的是对象的 key
+func bracketSegment(s string) pathSegment {
+	if s == "" {
+		return pathSegment{isIndex: true, index: -1}
+	}
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 && strings.TrimLeft(s, "0123456789") == "" {
+		return pathSegment{isIndex: true, index: n}
+	}
+	return pathSegment{key: s}
+}
+
+// setItemPath 把 value 放到 root 中 path[depth:] 所指的位置, 返回新的 root.
+// 路径上已有的值类型不对时报错, 比如 `a=1 a[b]=2`.
+func setItemPath(root interface{}, path []pathSegment, depth int, value interface{}) (interface{}, error) {
+	if depth == len(path) {
+		switch root.(type) {
+		case map[string]interface{}, []interface{}:
+			return nil, fmt.Errorf("cannot set %s: it is already an %s",
+				formatItemPath(path), jsonTypeName(root))
+		}
+		return value, nil
+	}
+
+	seg := path[depth]
+	if seg.isIndex {
+		arr, ok := root.([]interface{})
+		if root != nil && !ok {
+			return nil, fmt.Errorf("cannot set %s: %s is %s, not an array",
+				formatItemPath(path), formatItemPath(path[:depth]), articled(jsonTypeName(root)))
+		}
+		index := seg.index
+		if index < 0 {
+			index = len(arr)
+		}
+		if index > maxItemIndex {
+			return nil, fmt.Errorf("cannot set %s: index %d is too large", formatItemPath(path), index)
+		}
+		for len(arr) <= index {
+			arr = append(arr, nil)
+		}
+		v, err := setItemPath(arr[index], path, depth+1, value)
+		if err != nil {
+			return nil, err
+		}
+		arr[index] = v
+		return arr, nil
+	}
+
+	obj, ok := root.(map[string]interface{})
+	if root != nil && !ok {
+		return nil, fmt.Errorf("cannot set %s: %s is %s, not an object",
+			formatItemPath(path), formatItemPath(path[:depth]), articled(jsonTypeName(root)))
+	}
+	if obj == nil {
+		obj = map[string]interface{}{}
+	}
+	v, err := setItemPath(obj[seg.key], path, depth+1, value)
+	if err != nil {
+		return nil, err
+	}
+	obj[seg.key] = v
+	return obj, nil
+}
+
+// formatItemPath 把路径格式化为 `a[b][0]`
+func formatItemPath(path []pathSegment) string {
+	var buf bytes.Buffer
+	for i, seg := range path {
+		if i == 0 {
+			buf.WriteString(seg.key)
+			continue
+		}
+		buf.WriteString(seg.String())
+	}
+	return buf.String()
+}
+
+func jsonTypeName(v interface{}) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case string:
+		return "string"
+	case bool:
+		return "boolean"
+	case float64, json.Number:
+		return "number"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	}
+	return fmt.Sprintf("%T", v)
+}
+
+func articled(s string) string {
+	switch s[0] {
+	case 'a', 'e', 'i', 'o', 'u':
+		return "an " + s
+	}
+	return "a " + s
+}
@@ -0,0 +1,250 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// request item 的分隔符
+const (
+	sepQuery       = "=="
+	sepRawJSONFile = ":=@"
+	sepRawJSON     = ":="
+	sepDataFile    = "=@"
+	sepData        = "="
+	sepHeader      = ":"
+	sepFile        = "@"
+)
+
+// 同一位置上长的分隔符优先: `==` 和 `=@` 优先于 `=`, `:=@` 优先于 `:=` 和 `:`
+var itemSeparators = []string{
+	sepRawJSONFile, sepQuery, sepRawJSON, sepDataFile, sepData, sepHeader, sepFile,
+}
+
+// `=@` 和 `:=@` 参数中表示 stdin 的文件名
+const stdinFileName = "-"
+
+const itemEscape = '\\'
+
+type requestItem struct {
+	key string
+	// 保留了转义字符的 key, 用于解析嵌套的 JSON 路径
+	rawKey string
+	sep    string
+	value  string
+}
+
+// RequestItems request items parsed from the positional arguments
+type RequestItems struct {
+	query    url.Values
+	template map[string]interface{}
+	data     map[string]interface{}
+	// 按顺序保存的 `=`, `:=` 和 `@` 参数, 用于生成表单
+	fields []requestItem
+	// 值为空的 header 表示去掉该 header
+	headers http.Header
+}
+
+// 解析单个 request item, 分隔符前的 `\` 用于转义:
+// `a\=b=c` -> key: "a=b", value: "c"
+func parseRequestItem(s string) (item requestItem, err error) {
+	var key bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		if s[i] == itemEscape && i+1 < len(s) {
+			i++
+			key.WriteByte(s[i])
+			continue
+		}
+		for _, sep := range itemSeparators {
+			if strings.HasPrefix(s[i:], sep) {
+				item.key = key.String()
+				item.rawKey = s[:i]
+				item.sep = sep
+				item.value = s[i+len(sep):]
+				if item.key == "" {
+					err = fmt.Errorf("invalid request item %q: empty key", s)
+				}
+				return
+			}
+		}
+		key.WriteByte(s[i])
+	}
+	err = fmt.Errorf("invalid request item %q", s)
+	return
+}
+
+func parseRequestItems(items []string) (r RequestItems, err error) {
+	r.query = url.Values{}
+	r.template = map[string]interface{}{}
+	r.data = map[string]interface{}{}
+	r.headers = http.Header{}
+
+	for _, s := range items {
+		var item requestItem
+		if item, err = parseRequestItem(s); err != nil {
+			return
+		}
+		// 读取文件内容后当作 `=` 和 `:=` 参数处理
+		if item.sep == sepDataFile || item.sep == sepRawJSONFile {
+			var content []byte
+			if content, err = readItemFile(item.value); err != nil {
+				err = fmt.Errorf("request item %q: %s", s, err)
+				return
+			}
+			item.value = string(content)
+			item.sep = strings.TrimSuffix(item.sep, "@")
+		}
+		switch item.sep {
+		case sepQuery:
+			r.query.Add(item.key, item.value)
+		case sepData:
+			if err = r.setData(item, item.value); err != nil {
+				err = fmt.Errorf("request item %q: %s", s, err)
+				return
+			}
+			r.fields = append(r.fields, item)
+		case sepFile:
+			r.fields = append(r.fields, item)
+		case sepRawJSON:
+			v, e := decodeRawJSON(item.value)
+			if e != nil {
+				err = fmt.Errorf("invalid JSON in request item %q: %s", s, e)
+				return
+			}
+			if err = r.setData(item, v); err != nil {
+				err = fmt.Errorf("request item %q: %s", s, err)
+				return
+			}
+			r.fields = append(r.fields, item)
+		case sepHeader:
+			r.headers.Add(item.key, strings.TrimSpace(item.value))
+		}
+	}
+	return
+}
+
+// setData 按照 key 中的路径把 value 放到 JSON body 中:
+// `a[b][0]=x` 和 `a.b[0]=x` -> {"a": {"b": ["x"]}}
+func (r *RequestItems) setData(item requestItem, value interface{}) error {
+	path, err := parseItemPath(item.rawKey)
+	if err != nil {
+		return err
+	}
+	_, err = setItemPath(r.data, path, 0, value)
+	return err
+}
+
+// decodeRawJSON 解析 `:=` 参数的值, 数字保存为 json.Number, 避免大整数
+// 经过 float64 后丢失精度
+func decodeRawJSON(s string) (v interface{}, err error) {
+	dec := json.NewDecoder(strings.NewReader(s))
+	dec.UseNumber()
+	if err = dec.Decode(&v); err != nil {
+		return
+	}
+	if _, e := dec.Token(); e != io.EOF {
+		err = errors.New("invalid character after top-level value")
+	}
+	return
+}
+
+// readItemFile 读取 `=@` 和 `:=@` 参数引用的文件, `-` 表示 stdin
+func readItemFile(path string) ([]byte, error) {
+	if path == stdinFileName {
+		if ignoreStdin {
+			return nil, errors.New("stdin is ignored because of --ignore-stdin")
+		}
+		return readStdin()
+	}
+	return ioutil.ReadFile(path)
+}
+
+// 把 URL 模板中用到的 `==` 参数从 query 中移到 template 里:
+// `/<id> id==123` -> `/123`
+func (r *RequestItems) pullTemplateParams(uri string) {
+	for _, name := range tokens(uri) {
+		if values, ok := r.query[name]; ok {
+			r.template[name] = url.PathEscape(values[0])
+			r.query.Del(name)
+		}
+	}
+}
+
+func (r *RequestItems) hasData() bool {
+	return len(r.fields) > 0
+}
+
+// body 把 `=` 和 `:=` 参数组装成 JSON 格式的 request body.
+// form 为 true 时把 `=` 和 `@` 参数组装成表单: 有文件或者 multipart
+// 为 true 时使用 multipart/form-data, 否则使用 application/x-www-form-urlencoded
+func (r *RequestItems) body(form, multipart bool) (*requestBody, error) {
+	if !r.hasData() {
+		return nil, nil
+	}
+	if form || multipart {
+		return r.formBody(multipart)
+	}
+	for _, item := range r.fields {
+		if item.sep == sepFile {
+			return nil, fmt.Errorf("file upload item %q requires --form", item.key+item.sep+item.value)
+		}
+	}
+	b, err := json.Marshal(r.data)
+	if err != nil {
+		return nil, err
+	}
+	return newBytesBody(b, contentTypeJSON), nil
+}
+
+func (r *RequestItems) formBody(multipart bool) (*requestBody, error) {
+	parts := []formPart{}
+	hasFile := false
+	for _, item := range r.fields {
+		switch item.sep {
+		case sepRawJSON:
+			return nil, fmt.Errorf("raw JSON field %q cannot be used with --form", item.key)
+		case sepFile:
+			parts = append(parts, formPart{name: item.key, path: item.value})
+			hasFile = true
+		default:
+			parts = append(parts, formPart{name: item.key, value: item.value})
+		}
+	}
+	if hasFile || multipart {
+		return newMultipartBody(parts)
+	}
+
+	// 保持参数的顺序, 不使用会按 key 排序的 url.Values.Encode
+	pairs := make([]string, 0, len(parts))
+	for _, p := range parts {
+		pairs = append(pairs, url.QueryEscape(p.name)+"="+url.QueryEscape(p.value))
+	}
+	return newBytesBody([]byte(strings.Join(pairs, "&")), contentTypeForm), nil
+}
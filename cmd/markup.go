@@ -0,0 +1,297 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// HTML 中没有结束标签的元素
+var htmlVoidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "keygen": true, "link": true,
+	"meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// 内容中的空白有意义或者不是 HTML 的元素, 内容原样输出
+var htmlVerbatimElements = map[string]bool{
+	"pre": true, "textarea": true, "script": true, "style": true,
+}
+
+// 遇到这些开始标签时, 栈顶的这些元素隐式结束, 比如 <li>a<li>b, <p>a<div>
+var htmlImpliedEnd = map[string][]string{
+	"li":     {"li", "p"},
+	"option": {"option"},
+	"dt":     {"dt", "dd", "p"},
+	"dd":     {"dt", "dd", "p"},
+	"tr":     {"tr", "td", "th"},
+	"td":     {"td", "th"},
+	"th":     {"td", "th"},
+}
+
+func init() {
+	for _, tag := range []string{
+		"address", "article", "aside", "blockquote", "div", "dl", "fieldset",
+		"figure", "footer", "form", "h1", "h2", "h3", "h4", "h5", "h6", "header",
+		"hr", "main", "nav", "ol", "p", "pre", "section", "table", "ul",
+	} {
+		htmlImpliedEnd[tag] = []string{"p"}
+	}
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+// markupWriter 每个元素一行, 按照嵌套的层级缩进, 只包含一行文本的元素写在同一行
+type markupWriter struct {
+	buf   bytes.Buffer
+	depth int
+	// 上一个 token 是开始标签, 且还没有输出换行
+	open bool
+	// 开始标签之后只有文本
+	inline bool
+}
+
+func (w *markupWriter) newline() {
+	if w.buf.Len() > 0 {
+		w.buf.WriteByte('\n')
+	}
+	w.buf.WriteString(strings.Repeat("  ", w.depth))
+}
+
+func (w *markupWriter) start(tag string, void bool) {
+	w.newline()
+	w.buf.WriteString(tag)
+	if void {
+		w.open = false
+		return
+	}
+	w.depth++
+	w.open, w.inline = true, false
+}
+
+func (w *markupWriter) end(tag string) {
+	if w.depth > 0 {
+		w.depth--
+	}
+	if !w.open {
+		w.newline()
+	}
+	w.buf.WriteString(tag)
+	w.open, w.inline = false, false
+}
+
+// text 写入去掉首尾空白的文本, 多行文本每行单独缩进
+func (w *markupWriter) text(s string) {
+	lines := []string{}
+	for _, line := range strings.Split(s, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	if len(lines) == 1 && w.open && !w.inline {
+		w.buf.WriteString(lines[0])
+		w.inline = true
+		return
+	}
+	for _, line := range lines {
+		w.newline()
+		w.buf.WriteString(line)
+	}
+	if len(lines) > 0 {
+		w.open = false
+	}
+}
+
+// other 写入注释, doctype 之类单独一行的内容
+func (w *markupWriter) other(s string) {
+	w.newline()
+	w.buf.WriteString(s)
+	w.open = false
+}
+
+// indentXML 使用 RawToken 解析, 保留名字空间的前缀
+func indentXML(body []byte) (string, error) {
+	d := xml.NewDecoder(bytes.NewReader(body))
+	// body 已经是 UTF-8 了, 忽略 <?xml encoding="..."?> 的声明
+	d.CharsetReader = func(charset string, r io.Reader) (io.Reader, error) {
+		return r, nil
+	}
+
+	w := &markupWriter{}
+	// RawToken 不检查开始和结束标签是否匹配
+	stack := []xml.Name{}
+	for {
+		t, err := d.RawToken()
+		if err == io.EOF {
+			if len(stack) > 0 {
+				return "", fmt.Errorf("element <%s> is not closed", markupName(stack[len(stack)-1]))
+			}
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+		switch t := t.(type) {
+		case xml.StartElement:
+			stack = append(stack, t.Name)
+			var tag bytes.Buffer
+			tag.WriteString("<" + markupName(t.Name))
+			for _, attr := range t.Attr {
+				fmt.Fprintf(&tag, ` %s="%s"`, markupName(attr.Name), escapeMarkup(attr.Value, true))
+			}
+			tag.WriteString(">")
+			w.start(tag.String(), false)
+		case xml.EndElement:
+			if len(stack) == 0 || stack[len(stack)-1] != t.Name {
+				return "", fmt.Errorf("line %d: unexpected end element </%s>", lineOf(body, d.InputOffset()), markupName(t.Name))
+			}
+			stack = stack[:len(stack)-1]
+			if w.open && !w.inline {
+				// 空的元素: <a></a> -> <a/>
+				w.buf.Truncate(w.buf.Len() - 1)
+				w.end("/>")
+				continue
+			}
+			w.end("</" + markupName(t.Name) + ">")
+		case xml.CharData:
+			w.text(escapeMarkup(string(t), false))
+		case xml.Comment:
+			w.other("<!--" + string(t) + "-->")
+		case xml.ProcInst:
+			w.other("<?" + t.Target + " " + string(t.Inst) + "?>")
+		case xml.Directive:
+			w.other("<!" + string(t) + ">")
+		}
+	}
+	return w.buf.String(), nil
+}
+
+// indentHTML 使用 HTML5 的 tokenizer 解析, 标签, 文本和实体都保持原样,
+// 只调整换行和缩进. pre, textarea, script 和 style 的内容原样输出
+func indentHTML(body []byte) (string, error) {
+	z := html.NewTokenizer(bytes.NewReader(body))
+	w := &markupWriter{}
+	// 当前打开的元素
+	stack := []string{}
+	// 正在原样输出的元素
+	verbatim := ""
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() == io.EOF {
+				break
+			}
+			return "", z.Err()
+		}
+		raw := string(z.Raw())
+		name, _ := z.TagName()
+		tag := string(name)
+
+		if verbatim != "" {
+			if tt == html.EndTagToken && tag == verbatim {
+				verbatim = ""
+				w.buf.WriteString(raw)
+				w.open, w.inline = false, false
+				if w.depth > 0 {
+					w.depth--
+				}
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			w.buf.WriteString(raw)
+			continue
+		}
+
+		switch tt {
+		case html.StartTagToken:
+			for len(stack) > 0 && containsString(htmlImpliedEnd[tag], stack[len(stack)-1]) {
+				stack = stack[:len(stack)-1]
+				w.depth--
+				w.open = false
+			}
+			void := htmlVoidElements[tag]
+			w.start(raw, void)
+			if !void {
+				stack = append(stack, tag)
+				if htmlVerbatimElements[tag] {
+					verbatim = tag
+				}
+			}
+		case html.SelfClosingTagToken:
+			w.start(raw, true)
+		case html.EndTagToken:
+			// 没有对应开始标签的结束标签不影响缩进, 隐式结束的子元素一起出栈
+			i := len(stack) - 1
+			for i >= 0 && stack[i] != tag {
+				i--
+			}
+			if i < 0 {
+				w.other(raw)
+				continue
+			}
+			w.depth -= len(stack) - 1 - i
+			if len(stack)-1 > i {
+				w.open = false
+			}
+			stack = stack[:i]
+			w.end(raw)
+		case html.TextToken:
+			w.text(raw)
+		case html.CommentToken, html.DoctypeToken:
+			w.other(raw)
+		}
+	}
+	return w.buf.String(), nil
+}
+
+func lineOf(data []byte, offset int64) int {
+	return bytes.Count(data[:offset], []byte("\n")) + 1
+}
+
+func markupName(name xml.Name) string {
+	if name.Space != "" && !strings.Contains(name.Space, "/") {
+		return name.Space + ":" + name.Local
+	}
+	return name.Local
+}
+
+func escapeMarkup(s string, attr bool) string {
+	s = strings.Replace(s, "&", "&amp;", -1)
+	s = strings.Replace(s, "<", "&lt;", -1)
+	s = strings.Replace(s, ">", "&gt;", -1)
+	if attr {
+		s = strings.Replace(s, `"`, "&quot;", -1)
+	}
+	return s
+}
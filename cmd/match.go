@@ -0,0 +1,196 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+const wildcardPrefix = "*."
+
+// anyPort 匹配任意端口的 port
+const anyPort = "*"
+
+// hostRule 配置文件中 auths 的 key: [scheme://]host[:port][/path-prefix],
+// host 可以是 `*.example.com` 这样的通配符. 没有 port 时只匹配 scheme 的默认端口,
+// 避免把凭证发送给同一个 host 上的其他服务, port 为 `*` 时匹配任意端口
+type hostRule struct {
+	pattern  string
+	scheme   string
+	host     string
+	wildcard bool
+	port     string
+	path     string
+}
+
+func parseHostRule(pattern string) (r hostRule, err error) {
+	r.pattern = pattern
+	s := pattern
+	if i := strings.Index(s, "://"); i >= 0 {
+		r.scheme = strings.ToLower(s[:i])
+		s = s[i+3:]
+	}
+	if i := strings.Index(s, "/"); i >= 0 {
+		r.path = s[i:]
+		s = s[:i]
+	}
+	// [::1]:8080, example.com:8080
+	if i := strings.LastIndex(s, ":"); i > strings.LastIndex(s, "]") {
+		r.port = s[i+1:]
+		s = s[:i]
+	}
+	r.host = strings.ToLower(s)
+	if strings.HasPrefix(r.host, wildcardPrefix) {
+		r.wildcard = true
+		r.host = r.host[len(wildcardPrefix)-1:]
+	}
+
+	if r.host == "" || r.host == "." || strings.Contains(r.host, "*") {
+		err = fmt.Errorf("invalid host %q in %q", s, pattern)
+	} else if r.port != anyPort && strings.Trim(r.port, "0123456789") != "" {
+		err = fmt.Errorf("invalid port %q in %q", r.port, pattern)
+	}
+	return
+}
+
+func (r hostRule) match(u *url.URL) bool {
+	if r.scheme != "" && r.scheme != strings.ToLower(u.Scheme) {
+		return false
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if r.wildcard {
+		// r.host 以 `.` 开头: *.example.com -> .example.com
+		if !strings.HasSuffix(host, r.host) {
+			return false
+		}
+	} else if strings.Trim(r.host, "[]") != host {
+		return false
+	}
+
+	switch r.port {
+	case anyPort:
+	case "":
+		if port := u.Port(); port != "" && port != defaultPort(u.Scheme) {
+			return false
+		}
+	default:
+		if r.port != urlPort(u) {
+			return false
+		}
+	}
+
+	if r.path != "" {
+		p := u.Path
+		if p == "" {
+			p = "/"
+		}
+		if !strings.HasPrefix(p, r.path) {
+			return false
+		}
+		if !strings.HasSuffix(r.path, "/") && len(p) > len(r.path) && p[len(r.path)] != '/' {
+			return false
+		}
+	}
+	return true
+}
+
+// moreSpecific r 是否比 o 更具体: 非通配符优先于通配符, 更长的通配符优先,
+// 然后依次比较 path 前缀长度, 端口 (指定的端口, 默认端口, `*`), 是否指定了 scheme
+func (r hostRule) moreSpecific(o hostRule) bool {
+	if r.wildcard != o.wildcard {
+		return !r.wildcard
+	}
+	if len(r.host) != len(o.host) {
+		return len(r.host) > len(o.host)
+	}
+	if len(r.path) != len(o.path) {
+		return len(r.path) > len(o.path)
+	}
+	if r.portRank() != o.portRank() {
+		return r.portRank() > o.portRank()
+	}
+	if (r.scheme != "") != (o.scheme != "") {
+		return r.scheme != ""
+	}
+	return r.pattern < o.pattern
+}
+
+func (r hostRule) portRank() int {
+	switch r.port {
+	case anyPort:
+		return 0
+	case "":
+		return 1
+	}
+	return 2
+}
+
+// urlPort 返回 u 的端口, 没有指定端口时使用 scheme 的默认端口
+func urlPort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	return defaultPort(u.Scheme)
+}
+
+func defaultPort(scheme string) string {
+	switch strings.ToLower(scheme) {
+	case "https":
+		return "443"
+	case "http":
+		return "80"
+	}
+	return ""
+}
+
+// matchAuths 返回 auths 中匹配 u 的所有 key, 越具体的越靠前
+func matchAuths(auths map[string]configAuth, u *url.URL) []string {
+	rules := []hostRule{}
+	for pattern := range auths {
+		r, err := parseHostRule(pattern)
+		if err != nil || !r.match(u) {
+			continue
+		}
+		rules = append(rules, r)
+	}
+	sort.Slice(rules, func(i, j int) bool {
+		return rules[i].moreSpecific(rules[j])
+	})
+
+	keys := []string{}
+	for _, r := range rules {
+		keys = append(keys, r.pattern)
+	}
+	return keys
+}
+
+// matchAuth 返回 auths 中匹配 u 的最具体的配置
+func matchAuth(auths map[string]configAuth, u *url.URL) (value configAuth, ok bool) {
+	keys := matchAuths(auths, u)
+	if len(keys) == 0 {
+		return
+	}
+	return auths[keys[0]], true
+}
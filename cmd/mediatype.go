@@ -0,0 +1,192 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// mediaFormatter 按照 media type 输出 response body, body 已经被转换成 UTF-8
+type mediaFormatter func(dump *DumpConfig, body []byte) error
+
+// mediaFormatters 按 media type 注册的 formatter, `+json` 和 `+xml`
+// 结尾的类型分别使用 application/json 和 application/xml 的 formatter
+var mediaFormatters = map[string]mediaFormatter{
+	"application/json":                  formatJSONMedia,
+	"application/xml":                   formatXMLMedia,
+	"text/xml":                          formatXMLMedia,
+	"text/html":                         formatHTMLMedia,
+	"application/xhtml+xml":             formatHTMLMedia,
+	"application/x-www-form-urlencoded": formatFormMedia,
+}
+
+// 这些类型的 body 总是当作二进制数据
+var binaryMediaPrefixes = []string{
+	"image/", "audio/", "video/", "font/",
+	"application/octet-stream", "application/zip", "application/gzip",
+	"application/x-gzip", "application/x-tar", "application/pdf",
+	"application/x-protobuf", "application/vnd.",
+}
+
+func lookupMediaFormatter(mediaType string) (mediaFormatter, bool) {
+	if f, ok := mediaFormatters[mediaType]; ok {
+		return f, true
+	}
+	switch {
+	case isJSONMediaType(mediaType):
+		return mediaFormatters["application/json"], true
+	case strings.HasSuffix(mediaType, "+xml"):
+		return mediaFormatters["application/xml"], true
+	}
+	return nil, false
+}
+
+// printResponseBody 根据 Content-Type 选择 formatter 输出 response body:
+// 先按 charset 转换成 UTF-8, 二进制数据不输出到终端, 只有 JSON 类型的 body
+// 使用 --output-format, 没有对应的 formatter 或者 --pretty 不包含 format 时原样输出
+func (dump *DumpConfig) printResponseBody(body []byte, contentType string) error {
+	mediaType, params, _ := mime.ParseMediaType(contentType)
+	if isBinary(body, mediaType, params["charset"]) {
+		return dump.printBinary(body)
+	}
+	body, err := toUTF8(body, params["charset"])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gdhttp: %s, the body is printed as it is\n", err)
+	}
+
+	if dump.filter != nil {
+		if mediaType == "application/x-www-form-urlencoded" {
+			if body, err = formToJSON(body); err != nil {
+				return err
+			}
+		}
+		return dump.printFiltered(body)
+	}
+	f, ok := lookupMediaFormatter(mediaType)
+	// JSON 的 --pretty 和 --output-format 由 Formatter 处理
+	if ok && (dump.format || isJSONMediaType(mediaType)) {
+		return f(dump, body)
+	}
+	fmt.Println(string(body))
+	return nil
+}
+
+func isJSONMediaType(mediaType string) bool {
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
+
+func formatJSONMedia(dump *DumpConfig, body []byte) error {
+	return dump.printBody(body)
+}
+
+func formatXMLMedia(dump *DumpConfig, body []byte) error {
+	return printMarkup(body, "XML", indentXML)
+}
+
+func formatHTMLMedia(dump *DumpConfig, body []byte) error {
+	return printMarkup(body, "HTML", indentHTML)
+}
+
+// formatFormMedia 把 URL 编码的表单转换成 JSON 对象再输出, 同名的参数合并成数组
+func formatFormMedia(dump *DumpConfig, body []byte) error {
+	data, err := formToJSON(body)
+	if err != nil {
+		fmt.Println(string(body))
+		return nil
+	}
+	return dump.printBody(data)
+}
+
+func formToJSON(body []byte) ([]byte, error) {
+	values, err := url.ParseQuery(strings.TrimSpace(string(body)))
+	if err != nil {
+		return nil, err
+	}
+	obj := map[string]interface{}{}
+	for k, v := range values {
+		if len(v) == 1 {
+			obj[k] = v[0]
+		} else {
+			obj[k] = v
+		}
+	}
+	return json.Marshal(obj)
+}
+
+// printMarkup 用 indent 缩进 XML 或者 HTML, 解析失败时说明原因后原样输出
+func printMarkup(body []byte, kind string, indent func([]byte) (string, error)) error {
+	s, err := indent(body)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "gdhttp: cannot format the %s body, it is printed as it is: %s\n", kind, err)
+		s = string(body)
+	}
+	fmt.Println(strings.TrimRight(s, "\n"))
+	return nil
+}
+
+// isBinary 根据 media type 和内容判断 body 是否是二进制数据
+func isBinary(body []byte, mediaType, charset string) bool {
+	for _, prefix := range binaryMediaPrefixes {
+		if strings.HasPrefix(mediaType, prefix) && !strings.HasSuffix(mediaType, "+json") &&
+			!strings.HasSuffix(mediaType, "+xml") {
+			return true
+		}
+	}
+	if strings.HasPrefix(strings.ToLower(charset), "utf-16") {
+		return false
+	}
+	head := body
+	if len(head) > 8192 {
+		head = head[:8192]
+		// 不要把截断的多字节字符当成非法的 UTF-8
+		for i := 0; i < utf8.UTFMax && !utf8.Valid(head); i++ {
+			head = head[:len(head)-1]
+		}
+	}
+	if bytes.IndexByte(head, 0) >= 0 {
+		return true
+	}
+	return charset == "" && !utf8.Valid(head)
+}
+
+// printBinary 二进制数据输出到终端时默认不显示, --force-binary 时输出
+// hex dump; 重定向到文件或者管道时原样输出
+func (dump *DumpConfig) printBinary(body []byte) error {
+	if !dump.tty {
+		_, err := os.Stdout.Write(body)
+		return err
+	}
+	if !dump.forceBinary {
+		fmt.Printf("(binary body of %d bytes not shown, use --force-binary to show a hex dump)\n", len(body))
+		return nil
+	}
+	_, err := io.WriteString(os.Stdout, hex.Dump(body))
+	return err
+}
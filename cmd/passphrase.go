@@ -0,0 +1,76 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"runtime"
+	"strings"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// readPassword 从终端读取一行输入, 不回显. 提示信息输出到 stderr,
+// 这样 stdin 和 stdout 可以继续用于 request body 和 response
+func readPassword(prompt string) (string, error) {
+	return readTerminal(prompt, false)
+}
+
+// readLine 从终端读取一行输入
+func readLine(prompt string) (string, error) {
+	return readTerminal(prompt, true)
+}
+
+func readTerminal(prompt string, echo bool) (string, error) {
+	tty, err := os.OpenFile(ttyPath(), os.O_RDWR, 0)
+	if err != nil {
+		return "", errors.New("no terminal available to prompt for input")
+	}
+	defer tty.Close()
+
+	fd := int(tty.Fd())
+	if !echo && terminal.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, prompt)
+		b, err := terminal.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		return string(b), err
+	}
+	if !echo {
+		fmt.Fprintf(os.Stderr, "gdhttp: warning: cannot disable the terminal echo on %s, the input will be shown on the screen\n", runtime.GOOS)
+	}
+	fmt.Fprint(os.Stderr, prompt)
+	line, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && line == "" {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// ttyPath 终端的路径, windows 上是控制台
+func ttyPath() string {
+	if runtime.GOOS == "windows" {
+		return "CONIN$"
+	}
+	return "/dev/tty"
+}
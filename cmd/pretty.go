@@ -0,0 +1,253 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// --pretty 的取值
+const (
+	prettyAll    = "all"
+	prettyColors = "colors"
+	prettyFormat = "format"
+	prettyNone   = "none"
+)
+
+const defaultStyle = "default"
+
+const ansiReset = "\x1b[0m"
+
+// theme 输出中各个部分使用的 ANSI 颜色
+type theme struct {
+	method     string
+	url        string
+	proto      string
+	status     map[int]string // 按状态码的类别: 2, 3, 4, 5
+	headerName string
+	key        string
+	str        string
+	number     string
+	literal    string // true, false, null
+	punct      string
+}
+
+var themes = map[string]theme{
+	"default": {
+		method:     "\x1b[32m",
+		url:        "\x1b[36m",
+		proto:      "\x1b[34m",
+		status:     map[int]string{1: "\x1b[34m", 2: "\x1b[32m", 3: "\x1b[33m", 4: "\x1b[31m", 5: "\x1b[1;31m"},
+		headerName: "\x1b[36m",
+		key:        "\x1b[34m",
+		str:        "\x1b[33m",
+		number:     "\x1b[36m",
+		literal:    "\x1b[35m",
+		punct:      "",
+	},
+	"monokai": {
+		method:     "\x1b[38;5;148m",
+		url:        "\x1b[38;5;81m",
+		proto:      "\x1b[38;5;245m",
+		status:     map[int]string{1: "\x1b[38;5;81m", 2: "\x1b[38;5;148m", 3: "\x1b[38;5;186m", 4: "\x1b[38;5;208m", 5: "\x1b[38;5;197m"},
+		headerName: "\x1b[38;5;197m",
+		key:        "\x1b[38;5;197m",
+		str:        "\x1b[38;5;186m",
+		number:     "\x1b[38;5;141m",
+		literal:    "\x1b[38;5;81m",
+		punct:      "\x1b[38;5;231m",
+	},
+	"solarized": {
+		method:     "\x1b[38;5;64m",
+		url:        "\x1b[38;5;33m",
+		proto:      "\x1b[38;5;245m",
+		status:     map[int]string{1: "\x1b[38;5;33m", 2: "\x1b[38;5;64m", 3: "\x1b[38;5;136m", 4: "\x1b[38;5;166m", 5: "\x1b[38;5;160m"},
+		headerName: "\x1b[38;5;33m",
+		key:        "\x1b[38;5;33m",
+		str:        "\x1b[38;5;37m",
+		number:     "\x1b[38;5;125m",
+		literal:    "\x1b[38;5;166m",
+		punct:      "\x1b[38;5;245m",
+	},
+	// 只用粗体, 适合不支持颜色或者颜色难以辨认的终端
+	"mono": {
+		method:     "\x1b[1m",
+		proto:      "",
+		status:     map[int]string{1: "\x1b[1m", 2: "\x1b[1m", 3: "\x1b[1m", 4: "\x1b[1m", 5: "\x1b[1m"},
+		headerName: "\x1b[1m",
+		key:        "\x1b[1m",
+	},
+}
+
+func styleNames() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// prettyOptions 根据 --pretty 和 --style 决定是否格式化和着色输出,
+// pretty 为空时输出到终端使用 all, 否则使用 format
+func prettyOptions(pretty, style string, tty bool) (format bool, colors *theme, err error) {
+	if pretty == "" {
+		pretty = prettyFormat
+		if tty {
+			pretty = prettyAll
+		}
+	}
+	switch pretty {
+	case prettyAll:
+		format = true
+	case prettyColors:
+	case prettyFormat:
+		return true, nil, nil
+	case prettyNone:
+		return false, nil, nil
+	default:
+		return false, nil, fmt.Errorf("invalid --pretty %q, must be one of all, colors, format, none", pretty)
+	}
+
+	t, ok := themes[style]
+	if !ok {
+		return false, nil, fmt.Errorf("unknown --style %q, must be one of %s", style, strings.Join(styleNames(), ", "))
+	}
+	return format, &t, nil
+}
+
+func (t *theme) paint(color, s string) string {
+	if t == nil || color == "" || s == "" {
+		return s
+	}
+	return color + s + ansiReset
+}
+
+// paintName 给 header 名和 SSE 的字段名着色
+func (t *theme) paintName(s string) string {
+	if t == nil {
+		return s
+	}
+	return t.paint(t.headerName, s)
+}
+
+// colorHead 给 httputil.DumpRequest/DumpResponse 输出的请求行或状态行以及 header 着色
+func (t *theme) colorHead(head string) string {
+	if t == nil {
+		return head
+	}
+	lines := strings.SplitAfter(head, "\n")
+	for i, line := range lines {
+		content := strings.TrimRight(line, "\r\n")
+		eol := line[len(content):]
+		if content == "" {
+			continue
+		}
+		if i == 0 {
+			lines[i] = t.colorStartLine(content) + eol
+			continue
+		}
+		if n := strings.Index(content, ":"); n > 0 {
+			lines[i] = t.paint(t.headerName, content[:n]) + t.paint(t.punct, ":") + content[n+1:] + eol
+		}
+	}
+	return strings.Join(lines, "")
+}
+
+// colorStartLine `GET /foo HTTP/1.1` 或者 `HTTP/1.1 200 OK`
+func (t *theme) colorStartLine(line string) string {
+	fields := strings.SplitN(line, " ", 3)
+	if len(fields) < 2 {
+		return line
+	}
+	if strings.HasPrefix(fields[0], "HTTP/") {
+		color := ""
+		if len(fields[1]) == 3 && fields[1][0] >= '1' && fields[1][0] <= '5' {
+			color = t.status[int(fields[1][0]-'0')]
+		}
+		status := strings.Join(fields[1:], " ")
+		return t.paint(t.proto, fields[0]) + " " + t.paint(color, status)
+	}
+	s := t.paint(t.method, fields[0]) + " " + t.paint(t.url, fields[1])
+	if len(fields) > 2 {
+		s += " " + t.paint(t.proto, fields[2])
+	}
+	return s
+}
+
+// colorJSON 给合法的 JSON 文本着色, 不改变其中的空白
+func (t *theme) colorJSON(s string) string {
+	if t == nil {
+		return s
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '"':
+			end := stringEnd(s, i)
+			color := t.str
+			// 后面紧跟 `:` 的字符串是对象的 key
+			if rest := strings.TrimLeft(s[end:], " \t\r\n"); strings.HasPrefix(rest, ":") {
+				color = t.key
+			}
+			buf.WriteString(t.paint(color, s[i:end]))
+			i = end
+		case c == '-' || (c >= '0' && c <= '9'):
+			end := i + 1
+			for end < len(s) && strings.IndexByte("0123456789.eE+-", s[end]) >= 0 {
+				end++
+			}
+			buf.WriteString(t.paint(t.number, s[i:end]))
+			i = end
+		case c == 't' || c == 'f' || c == 'n':
+			end := i + 1
+			for end < len(s) && s[end] >= 'a' && s[end] <= 'z' {
+				end++
+			}
+			buf.WriteString(t.paint(t.literal, s[i:end]))
+			i = end
+		case strings.IndexByte("{}[],:", c) >= 0:
+			buf.WriteString(t.paint(t.punct, string(c)))
+			i++
+		default:
+			buf.WriteByte(c)
+			i++
+		}
+	}
+	return buf.String()
+}
+
+// stringEnd 返回从 start 开始的 JSON 字符串结束后的位置
+func stringEnd(s string, start int) int {
+	for i := start + 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
+	}
+	return len(s)
+}
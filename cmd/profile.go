@@ -0,0 +1,148 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+)
+
+const profileEnv = "GDHTTP_PROFILE"
+
+type configTLS struct {
+	Insecure   bool   `json:"insecure"`
+	CACert     string `json:"caCert"`
+	ClientCert string `json:"clientCert"`
+	ClientKey  string `json:"clientKey"`
+}
+
+type configProfile struct {
+	BaseURL          string            `json:"baseURL"`
+	Auth             configAuth        `json:"auth"`
+	CredentialHelper string            `json:"credentialHelper"`
+	Headers          map[string]string `json:"headers"`
+	Timeout          int64             `json:"timeout"`
+	TLS              configTLS         `json:"tls"`
+}
+
+// selectedProfileName 按 --profile, $GDHTTP_PROFILE, 配置文件中的 defaultProfile
+// 的顺序选择使用的 profile
+func selectedProfileName(config Config) string {
+	if profileName != "" {
+		return profileName
+	}
+	if name := os.Getenv(profileEnv); name != "" {
+		return name
+	}
+	return config.DefaultProfile
+}
+
+func selectProfile(config Config) (p configProfile, err error) {
+	name := selectedProfileName(config)
+	if name == "" {
+		return
+	}
+	p, ok := config.Profiles[name]
+	if !ok {
+		err = fmt.Errorf("profile %q not found in config file", name)
+	}
+	return
+}
+
+// resolveBaseURL /api/v1/jobs -> <baseURL>/api/v1/jobs
+func resolveBaseURL(uri, baseURL string) string {
+	if baseURL == "" || !strings.HasPrefix(uri, "/") {
+		return uri
+	}
+	return strings.TrimRight(baseURL, "/") + uri
+}
+
+// mergeHeaders 把 profile 中的 headers 合并到 headers 中, headers 中已有的优先.
+// 配置文件中跨多行的值 (比如 YAML 的 `|` 和 `>`) 会合并为一行
+func mergeHeaders(headers http.Header, profileHeaders map[string]string) {
+	for key, value := range profileHeaders {
+		key = http.CanonicalHeaderKey(key)
+		if _, ok := headers[key]; ok {
+			continue
+		}
+		lines := []string{}
+		for _, line := range strings.Split(value, "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				lines = append(lines, line)
+			}
+		}
+		headers.Set(key, strings.Join(lines, " "))
+	}
+}
+
+// newTransport 根据 TLS 配置创建 http.Transport, 没有 TLS 配置时返回 nil
+func newTransport(c configTLS) (*http.Transport, error) {
+	if c == (configTLS{}) {
+		return nil, nil
+	}
+	tlsConfig := &tls.Config{InsecureSkipVerify: c.Insecure}
+
+	if c.CACert != "" {
+		p, err := absPathify(c.CACert)
+		if err != nil {
+			return nil, err
+		}
+		pem, err := ioutil.ReadFile(p)
+		if err != nil {
+			return nil, err
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", p)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if c.ClientCert != "" || c.ClientKey != "" {
+		if c.ClientCert == "" || c.ClientKey == "" {
+			return nil, errors.New("both clientCert and clientKey are required")
+		}
+		certFile, err := absPathify(c.ClientCert)
+		if err != nil {
+			return nil, err
+		}
+		keyFile, err := absPathify(c.ClientKey)
+		if err != nil {
+			return nil, err
+		}
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	// 保留默认 transport 的超时, 连接池和 HTTP/2 设置
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = tlsConfig
+	return transport, nil
+}
@@ -31,11 +31,13 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"os"
+	"strings"
 	"time"
 
-	"bitbucket.org/mozillazg/gdauth"
+	"bitbucket.org/mozillazg/gdhttp/auth"
 	"github.com/mattn/go-isatty"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 const version = "0.5.0"
@@ -44,10 +46,9 @@ const defaultScheme = "http"
 const defaultHost = "localhost"
 
 var defaultHeaders = map[string]string{
-	"Content-Type":    "application/json",
 	"User-Agent":      "gdhttp/" + version,
 	"Accept":          "application/json",
-	"Accept-Encoding": "application/json",
+	"Accept-Encoding": acceptEncoding,
 	"Connection":      "keep-alive",
 	// "Content-Length":  "0",
 }
@@ -55,19 +56,45 @@ var defaultHeaders = map[string]string{
 const defaultTimeout int64 = 30
 
 var cfgFile string
+var profileName string
+var config Config
+var profile configProfile
 var accessKeyID string
 var accessKeySecret string
 var onlyBody bool
+var onlyHeaders bool
+var printParts string
 var noAuth bool
+var authType string
+var signatureMethod string
+var authCredentials string
+var contentMD5 bool
+var debugSignature bool
 var verbose bool
+var download bool
+var outputFile string
+var resume bool
+var stream bool
+var filterExpr string
+var rawOutput bool
+var outputFormat string
+var columns string
+var forceBinary bool
+var rawEncoding bool
+var prettyMode string
+var style string
 var askVersion bool
 var httpMethod string
 var uri *url.URL
 var requestItems []string
 var timeout int64
-var params []byte
+var form bool
+var multipartForm bool
+var ignoreStdin bool
+var reqBody *requestBody
 
 var RootCmd = &cobra.Command{
+	Use: "gdhttp",
 	PreRun: func(cmd *cobra.Command, args []string) {
 		if askVersion {
 			fmt.Println(version)
@@ -80,38 +107,137 @@ var RootCmd = &cobra.Command{
 		}
 	},
 	Run: func(cmd *cobra.Command, args []string) {
-		pa, err := parsePositionalArguments(args)
+		initConfig(cmd)
+		pa := loadRequest(args)
+		dumpConfig, err := newDumpConfig(printSpec(printParts, verbose, onlyBody, onlyHeaders))
 		if err != nil {
-			fmt.Println(usageShort())
-			fmt.Println(errorString(err))
-			os.Exit(1)
+			exitWithError(err)
 		}
-		if !isatty.IsTerminal(os.Stdin.Fd()) {
-			if params, err = ioutil.ReadAll(os.Stdin); err != nil {
+		dumpConfig.stream = stream
+		if columns != "" {
+			dumpConfig.columns = strings.Split(columns, ",")
+		}
+		if dumpConfig.formatter, err = newFormatter(outputFormat, dumpConfig); err != nil {
+			exitWithError(err)
+		}
+		dumpConfig.rawOutput = rawOutput
+		if filterExpr != "" || rawOutput {
+			if filterExpr == "" {
+				filterExpr = "."
+			}
+			if dumpConfig.filter, err = compileFilter(filterExpr); err != nil {
 				exitWithError(err)
 			}
 		}
-		httpMethod = pa.httpMethod
-		requestItems = pa.requestItems
-		uri = pa.uri
-		dumpConfig := &DumpConfig{
-			verbose:  verbose,
-			onlyBody: onlyBody,
+		dumpConfig.tty = isatty.IsTerminal(os.Stdout.Fd())
+		dumpConfig.forceBinary = forceBinary
+		dumpConfig.rawEncoding = rawEncoding
+		dumpConfig.showEncoding = verbose
+		dumpConfig.format, dumpConfig.colors, err = prettyOptions(prettyMode, style, dumpConfig.tty)
+		if err != nil {
+			exitWithError(err)
+		}
+		initAuth()
+
+		authenticator, err := newAuthenticator()
+		if err != nil {
+			exitWithError(err)
+		}
+		c := NewClient(authenticator, time.Duration(timeout)*time.Second)
+		c.debugSignature = debugSignature
+		if transport, err := newTransport(profile.TLS); err != nil {
+			exitWithError(err)
+		} else if transport != nil {
+			c.Transport = transport
 		}
-		initConfig()
 
-		c := NewClient(accessKeyID, accessKeySecret, time.Duration(timeout)*time.Second)
+		var hook Hook = dumpConfig
+		var d *downloader
+		if download || outputFile != "" {
+			if d, err = newDownloader(dumpConfig, outputFile, resume); err != nil {
+				exitWithError(err)
+			}
+			if r := d.rangeHeader(); r != "" {
+				pa.items.headers.Set("Range", r)
+			}
+			// Range, Content-MD5 和 Digest 都是针对压缩后的数据, 下载时不压缩
+			if _, ok := pa.items.headers["Accept-Encoding"]; !ok {
+				pa.items.headers.Set("Accept-Encoding", "identity")
+			}
+			c.disableBodyTimeout()
+			hook = d
+		}
+		if stream {
+			c.disableBodyTimeout()
+		}
 		resp, err := c.doRequest(
-			httpMethod, uri, params, noAuth, dumpConfig,
+			httpMethod, uri, pa.items.headers, reqBody, hook,
 		)
 		if err != nil {
 			exitWithError(err)
 		}
-		defer resp.Body.Close()
+		resp.Body.Close()
+		if d != nil && d.err != nil {
+			exitWithError(d.err)
+		}
+		if dumpConfig.err != nil {
+			exitWithError(dumpConfig.err)
+		}
 	},
 }
 
+// loadRequest 解析位置参数并读取 request body, 出错时直接退出
+func loadRequest(args []string) PositionalArgument {
+	pa, err := parsePositionalArguments(args)
+	if err != nil {
+		fmt.Println(usageShort())
+		fmt.Println(errorString(err))
+		os.Exit(1)
+	}
+	mergeHeaders(pa.items.headers, profile.Headers)
+	// stdin 已经被 `@-` 参数读取时不再作为 request body
+	var stdin []byte
+	if !ignoreStdin && !stdinRead && !isatty.IsTerminal(os.Stdin.Fd()) {
+		if stdin, err = readStdin(); err != nil {
+			exitWithError(err)
+		}
+	}
+	if len(stdin) > 0 {
+		contentType := contentTypeJSON
+		if form {
+			contentType = contentTypeForm
+		}
+		reqBody = newBytesBody(stdin, contentType)
+	}
+	if pa.items.hasData() {
+		if !methodHasBody(pa.httpMethod) {
+			exitWithError(fmt.Errorf("request data items cannot be sent with %s, use a method that carries a body, e.g. POST", pa.httpMethod))
+		}
+		if len(stdin) > 0 {
+			exitWithError(errors.New("request body from stdin and request data items cannot be mixed"))
+		}
+		if reqBody, err = pa.items.body(form, multipartForm); err != nil {
+			exitWithError(err)
+		}
+	}
+	httpMethod = pa.httpMethod
+	requestItems = pa.requestItems
+	uri = pa.uri
+	return pa
+}
+
+// addRequestFlags 添加发送请求的命令共用的参数
+func addRequestFlags(flags *pflag.FlagSet) {
+	flags.BoolVarP(&form, "form", "f", false, "Send the data items as a form, 'field@path' items upload files")
+	flags.BoolVar(&multipartForm, "multipart", false, "Send the form as multipart/form-data even without files")
+	flags.BoolVar(&ignoreStdin, "ignore-stdin", false, "Do not read the request body from stdin")
+}
+
 func Execute() {
+	// 第一个参数不是子命令时当作普通请求处理, 比如 `gdhttp GET /foo`
+	if _, _, err := RootCmd.Find(os.Args[1:]); err != nil {
+		RootCmd.ResetCommands()
+	}
 	if err := RootCmd.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -119,53 +245,173 @@ func Execute() {
 }
 
 func init() {
-	RootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "config file (default is $HOME/.gdhttp.json)")
+	RootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "config file in JSON, YAML or TOML format (default is $HOME/.gdhttp.json)")
+	RootCmd.PersistentFlags().StringVarP(&profileName, "profile", "p", "", "The profile in the config file to be used (default is $GDHTTP_PROFILE)")
 	RootCmd.PersistentFlags().StringVar(&accessKeyID, "access-key-id", "", "Access key ID")
 	RootCmd.PersistentFlags().StringVar(&accessKeySecret, "access-key-secret", "", "Access key secret")
 	RootCmd.PersistentFlags().BoolVarP(&onlyBody, "body", "b", false, "Print only the response body")
+	RootCmd.PersistentFlags().BoolVar(&onlyHeaders, "headers", false, "Print only the response headers")
+	RootCmd.PersistentFlags().StringVar(&printParts, "print", "", "What to print: H request headers, B request body, h response headers, b response body (default: hb)")
 	RootCmd.PersistentFlags().BoolVar(&noAuth, "no-auth", false, "Don't add Authorization header")
+	RootCmd.PersistentFlags().StringVarP(&authType, "auth-type", "A", "", "The authentication mechanism to be used: genedock, basic, bearer, digest (default: genedock)")
+	RootCmd.PersistentFlags().StringVarP(&authCredentials, "auth", "a", "", "USER[:PASS] for basic and digest auth, TOKEN for bearer auth")
+	RootCmd.PersistentFlags().StringVar(&signatureMethod, "signature-method", "", "The signature method of genedock auth: hmac-sha1-v1, hmac-sha256-v1 (default: hmac-sha1-v1)")
+	RootCmd.PersistentFlags().BoolVar(&contentMD5, "content-md5", false, "Add Content-MD5 header of the request body and sign it")
+	addRequestFlags(RootCmd.Flags())
+	RootCmd.Flags().BoolVarP(&download, "download", "d", false, "Save the response body to a file instead of printing it")
+	RootCmd.Flags().StringVarP(&outputFile, "output", "o", "", "The file to save the response body to, implies --download")
+	RootCmd.Flags().BoolVar(&resume, "continue", false, "Resume an interrupted download of --output")
+	RootCmd.Flags().BoolVarP(&stream, "stream", "S", false, "Print the response body as it arrives, e.g. NDJSON and Server-Sent Events")
+	RootCmd.Flags().StringVarP(&filterExpr, "filter", "q", "", "Print only the parts of the JSON response body selected by a jq-like expression")
+	RootCmd.Flags().BoolVarP(&rawOutput, "raw-output", "r", false, "Print strings selected by --filter without quotes")
+	RootCmd.Flags().StringVar(&outputFormat, "output-format", defaultOutputFormat, "Format of the JSON response body: "+strings.Join(outputFormatNames(), ", "))
+	RootCmd.Flags().StringVar(&columns, "columns", "", "Comma separated columns to show with --output-format=table|csv")
+	RootCmd.Flags().BoolVar(&forceBinary, "force-binary", false, "Print a hex dump of a binary response body to the terminal")
+	RootCmd.Flags().BoolVar(&rawEncoding, "raw-encoding", false, "Don't decode gzip, deflate or br compressed response bodies")
+	RootCmd.Flags().BoolVar(&debugSignature, "debug-signature", false, "Print the string-to-sign and signature to stderr")
 	RootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Verbose output. Print the whole request as well as the response")
+	RootCmd.PersistentFlags().StringVar(&prettyMode, "pretty", "", "Output processing: all, colors, format, none (default: all for a terminal, format otherwise)")
+	RootCmd.PersistentFlags().StringVar(&style, "style", defaultStyle, "Color theme of the output: "+strings.Join(styleNames(), ", "))
 	RootCmd.PersistentFlags().Int64VarP(&timeout, "timeout", "t", defaultTimeout, "The connection timeout of the request in seconds (default: 30)")
 	RootCmd.PersistentFlags().BoolVarP(&askVersion, "version", "V", false, "Show version and exit")
 
 	RootCmd.SetUsageFunc(func(cmd *cobra.Command) error {
+		if cmd != RootCmd {
+			fmt.Println(usageSubcommand(cmd))
+			return nil
+		}
 		fmt.Println(usageDetail())
 		return nil
 	})
 }
 
 // initConfig reads in config file and ENV variables if set.
-func initConfig() {
-	if cfgFile == "" {
-		cfgFile = defaultConfigPath
+func initConfig(cmd *cobra.Command) {
+	var err error
+	config = loadConfig()
+	if profile, err = selectProfile(config); err != nil {
+		exitWithError(err)
+	}
+	if !cmd.Flags().Changed("timeout") && profile.Timeout > 0 {
+		timeout = profile.Timeout
+	}
+}
+
+// initAuth 依次从命令行参数, 环境变量, profile, 配置文件中匹配 uri 的 auths,
+// vault 和 credential helper 中选择第一组完整的凭证. 凭证以及它的认证方式和
+// 签名方法都来自同一个地方, 不会混用不同来源的 access key id 和 secret
+func initAuth() {
+	if (accessKeyID == "") != (accessKeySecret == "") {
+		exitWithError(errors.New("--access-key-id and --access-key-secret must be given together"))
+	}
+	envID, envSecret := os.Getenv(accessKeyIDEnv), os.Getenv(accessKeySecretEnv)
+	if (envID == "") != (envSecret == "") {
+		exitWithError(fmt.Errorf("$%s and $%s must be set together", accessKeyIDEnv, accessKeySecretEnv))
 	}
-	cfgFile, err := absPathify(cfgFile)
+
+	if useAuth(configAuth{AccessKeyID: accessKeyID, AccessKeySecret: accessKeySecret, Token: authCredentials}) ||
+		useAuth(configAuth{AccessKeyID: envID, AccessKeySecret: envSecret}) ||
+		useAuth(profile.Auth) {
+		return
+	}
+	if value, ok := matchAuth(config.Auths, uri); ok && useAuth(value) {
+		return
+	}
+	if noAuth {
+		return
+	}
+	value, ok, err := vaultAuth(uri)
 	if err != nil {
+		exitWithError(err)
+	}
+	if ok && useAuth(value) {
 		return
 	}
 
-	config, err := parseConfig(cfgFile)
+	helper := profile.CredentialHelper
+	if helper == "" {
+		helper = config.CredentialHelper
+	}
+	if helper == "" {
+		return
+	}
+	if value, err = runCredentialHelper(helper, uri); err != nil {
+		exitWithError(err)
+	}
+	useAuth(value)
+}
+
+// loadConfig 读取配置文件, 配置文件不存在时返回空的配置
+func loadConfig() (config Config) {
+	cfgFile, err := configPath()
+	if err != nil {
+		return
+	}
+
+	config, err = parseConfig(cfgFile)
 	if err != nil {
 		if _, ok := err.(*os.PathError); ok {
 			return
 		} else {
-			msg := fmt.Sprintf("parse config file %s error %s", cfgFile, err)
+			msg := fmt.Sprintf("parse config file error %s", err)
 			exitWithError(errors.New(msg))
 		}
 	}
+	return
+}
+
+// newAuthenticator 根据认证方式和凭证创建 Authenticator, --no-auth 时返回 nil
+func newAuthenticator() (auth.Authenticator, error) {
+	if noAuth {
+		return nil, nil
+	}
+	cred := auth.Credentials{
+		AccessKeyID:     accessKeyID,
+		AccessKeySecret: accessKeySecret,
+		SignatureMethod: signatureMethod,
+		Token:           authCredentials,
+	}
+	arr := strings.SplitN(authCredentials, ":", 2)
+	cred.Username = arr[0]
+	if len(arr) > 1 {
+		cred.Password = arr[1]
+	}
 
-	if value, ok := config.Auths[uri.Host]; ok {
-		accessKeyID = value.AccessKeyID
-		accessKeySecret = value.AccessKeySecret
+	authenticator, err := auth.New(authType, cred)
+	if err != nil {
+		return nil, err
+	}
+	if sign, ok := authenticator.(*auth.Signature); ok {
+		sign.ContentMD5 = contentMD5
 	}
+	return authenticator, nil
 }
 
 // Client ...
 type Client struct {
 	http.Client
-	accessKeyID     string
-	accessKeySecret string
-	sign            gdauth.Signature
+	auth           auth.Authenticator
+	debugSignature bool
+}
+
+// disableBodyTimeout 去掉 http.Client.Timeout, 只限制等待响应头的时间,
+// 这样下载大文件时读取 body 不会超时
+func (c *Client) disableBodyTimeout() {
+	if c.Timeout == 0 {
+		return
+	}
+	var transport *http.Transport
+	switch t := c.Transport.(type) {
+	case nil:
+		transport = http.DefaultTransport.(*http.Transport).Clone()
+	case *http.Transport:
+		transport = t
+	default:
+		return
+	}
+	transport.ResponseHeaderTimeout = c.Timeout
+	c.Transport = transport
+	c.Timeout = 0
 }
 
 // Hook for request
@@ -174,69 +420,159 @@ type Hook interface {
 	after(resp *http.Response)
 }
 
+// --print 中表示各个部分的字符
+const (
+	printRequestHeaders  = 'H'
+	printRequestBody     = 'B'
+	printResponseHeaders = 'h'
+	printResponseBody    = 'b'
+)
+
 // DumpConfig config for dump http request and response
 type DumpConfig struct {
-	verbose  bool
-	onlyBody bool
+	requestHeaders  bool
+	requestBody     bool
+	responseHeaders bool
+	responseBody    bool
+	// 是否边接收边输出 response body
+	stream bool
+	// --filter 表达式, 为 nil 时输出整个 body
+	filter    *filter
+	rawOutput bool
+	// --output-format 对应的 Formatter 以及 table 和 csv 输出的列
+	formatter Formatter
+	columns   []string
+	// 是否缩进 JSON
+	format bool
+	// 为 nil 时不着色
+	colors *theme
+	// stdout 是否是终端, 二进制 body 只有 --force-binary 时才输出到终端
+	tty         bool
+	forceBinary bool
+	// --raw-encoding 时不解压 body, showEncoding 时显示解压前后的大小
+	rawEncoding  bool
+	showEncoding bool
+	// 输出 body 时的错误, 比如 --filter 求值出错
+	err error
 }
 
-// NewClient ...
-func NewClient(accessKeyID, accessKeySecret string, timeout time.Duration) *Client {
+// NewClient authenticator 为 nil 时不加认证信息
+func NewClient(authenticator auth.Authenticator, timeout time.Duration) *Client {
 	c := http.Client{}
 	c.Timeout = timeout
 	return &Client{
-		Client:          c,
-		accessKeyID:     accessKeyID,
-		accessKeySecret: accessKeySecret,
+		Client: c,
+		auth:   authenticator,
 	}
 }
 
-func (c *Client) doRequest(method string, uri *url.URL, params []byte, noAuth bool, hook Hook) (resp *http.Response, err error) {
-	var body io.Reader
-	if params != nil && len(params) > 0 {
-		switch method {
-		case http.MethodGet:
-		case http.MethodHead:
-		case http.MethodOptions:
+func (c *Client) doRequest(method string, uri *url.URL, headers http.Header, body *requestBody, hook Hook) (resp *http.Response, err error) {
+	req, err := c.newRequest(method, uri, headers, body)
+	if err != nil {
+		return
+	}
 
-		default:
-			body = bytes.NewReader(params)
+	resp, err = c.Do(req)
+
+	// Digest 之类的认证需要根据 401 响应重新发送请求
+	if challenger, ok := c.auth.(auth.Challenger); ok && err == nil &&
+		resp.StatusCode == http.StatusUnauthorized && challenger.Challenge(resp) {
+		resp.Body.Close()
+		if req, err = c.newRequest(method, uri, headers, body); err != nil {
+			return
 		}
+		resp, err = c.Do(req)
 	}
-	req, err := http.NewRequest(method, uri.String(), body)
+
+	// 只输出最后发送的 request, 发送失败时也输出
+	hook.before(req)
+	if err != nil {
+		return
+	}
+	hook.after(resp)
+	return
+}
+
+func (c *Client) newRequest(method string, uri *url.URL, headers http.Header, body *requestBody) (req *http.Request, err error) {
+	if !methodHasBody(method) {
+		body = nil
+	}
+	var reader io.ReadCloser
+	if body != nil {
+		if reader, err = body.open(); err != nil {
+			return
+		}
+	}
+	req, err = http.NewRequest(method, uri.String(), reader)
 	if err != nil {
 		return
 	}
 	for key, value := range defaultHeaders {
 		req.Header.Set(key, value)
 	}
-	if !noAuth {
-		sign := gdauth.Signature{
-			Method:          gdauth.HMACSHA1V1,
-			AccessKeyID:     c.accessKeyID,
-			AccessKeySecret: c.accessKeySecret,
-		}
-		sign.SignReq(req)
+	if body != nil {
+		req.ContentLength = body.length
+		req.GetBody = body.open
+		req.Header.Set("Content-Type", body.contentType)
 	}
-
-	hook.before(req)
-
-	if resp, err = c.Do(req); err != nil {
+	setHeaders(req, headers)
+	if c.auth == nil {
 		return
 	}
-
-	hook.after(resp)
+	if err = c.auth.Authenticate(req); err != nil {
+		return
+	}
+	if sign, ok := c.auth.(*auth.Signature); ok && c.debugSignature {
+		err = printSignature(os.Stderr, sign, req)
+	}
 	return
 }
 
+// setHeaders 用 headers 覆盖 req 的 header, 值为空时去掉该 header
+func setHeaders(req *http.Request, headers http.Header) {
+	for key, values := range headers {
+		req.Header.Del(key)
+		for _, value := range values {
+			if value == "" {
+				continue
+			}
+			if key == "Host" {
+				req.Host = value
+				continue
+			}
+			req.Header.Add(key, value)
+		}
+	}
+}
+
 type configAuth struct {
-	AccessKeyID     string `json:"accessKeyID"`
-	AccessKeySecret string `json:"accessKeySecret"`
+	Type            string `json:"type,omitempty"`
+	AccessKeyID     string `json:"accessKeyID,omitempty"`
+	AccessKeySecret string `json:"accessKeySecret,omitempty"`
+	SignatureMethod string `json:"signatureMethod,omitempty"`
+	Username        string `json:"username,omitempty"`
+	Password        string `json:"password,omitempty"`
+	Token           string `json:"token,omitempty"`
+}
+
+// credentials 返回与 --auth 参数格式相同的凭证
+func (a configAuth) credentials() string {
+	if a.Token != "" {
+		return a.Token
+	}
+	if a.Password != "" {
+		return a.Username + ":" + a.Password
+	}
+	return a.Username
 }
 
 // Config ...
 type Config struct {
-	Auths map[string]configAuth `json:"auths"`
+	Auths            map[string]configAuth    `json:"auths"`
+	CredentialHelper string                   `json:"credentialHelper"`
+	Vault            string                   `json:"vault"`
+	DefaultProfile   string                   `json:"defaultProfile"`
+	Profiles         map[string]configProfile `json:"profiles"`
 }
 
 func parseConfig(p string) (config Config, err error) {
@@ -249,38 +585,172 @@ func parseConfig(p string) (config Config, err error) {
 		return
 	}
 
-	err = json.Unmarshal(data, &config)
+	jsonData, err := configJSON(p, data)
+	if err != nil {
+		return
+	}
+	if configFormat(p) != configFormatJSON {
+		data = nil
+	}
+	if err = json.Unmarshal(jsonData, &config); err != nil {
+		err = newConfigError(p, data, err)
+	}
 	return
 }
 
+// printSpec 返回 --print 的值, 没有指定时根据 --verbose, --body 和 --headers 生成
+func printSpec(spec string, verbose, onlyBody, onlyHeaders bool) string {
+	if spec != "" {
+		return spec
+	}
+	spec = "hb"
+	if verbose {
+		spec = "HBhb"
+	}
+	if onlyBody {
+		spec = strings.Replace(spec, "h", "", -1)
+	}
+	if onlyHeaders {
+		spec = strings.Replace(spec, "b", "", -1)
+	}
+	return spec
+}
+
+func newDumpConfig(spec string) (*DumpConfig, error) {
+	dump := &DumpConfig{}
+	for _, c := range spec {
+		switch c {
+		case printRequestHeaders:
+			dump.requestHeaders = true
+		case printRequestBody:
+			dump.requestBody = true
+		case printResponseHeaders:
+			dump.responseHeaders = true
+		case printResponseBody:
+			dump.responseBody = true
+		default:
+			return nil, fmt.Errorf("invalid --print %q: unknown part %q, must be any of H, B, h, b", spec, c)
+		}
+	}
+	return dump, nil
+}
+
 func (dump *DumpConfig) before(req *http.Request) {
-	if dump.verbose {
-		b, _ := httputil.DumpRequest(req, true)
-		fmt.Println(string(b))
-		fmt.Println("")
+	if !dump.requestHeaders && !dump.requestBody {
+		return
+	}
+	if dump.requestHeaders {
+		head, _ := httputil.DumpRequest(req, false)
+		fmt.Print(dump.colors.colorHead(string(head)))
 	}
+	if dump.requestBody {
+		dump.printRequestBody(req)
+	}
+	fmt.Println("")
+}
+
+func (dump *DumpConfig) printRequestBody(req *http.Request) {
+	// multipart 表单可能包含很大的文件, 不输出 body
+	if strings.HasPrefix(req.Header.Get("Content-Type"), "multipart/") {
+		fmt.Printf("(multipart body of %d bytes not shown)\n", req.ContentLength)
+		return
+	}
+	var body []byte
+	if req.GetBody != nil {
+		if rc, err := req.GetBody(); err == nil {
+			body, _ = ioutil.ReadAll(rc)
+			rc.Close()
+		}
+	}
+	fmt.Println(dump.formatBody(body))
 }
 
 func (dump *DumpConfig) after(resp *http.Response) {
-	if !dump.onlyBody {
+	if dump.responseHeaders {
 		b, _ := httputil.DumpResponse(resp, false)
-		fmt.Print(string(b))
+		fmt.Print(dump.colors.colorHead(string(b)))
+	}
+	if !dump.responseBody {
+		return
+	}
+	var body io.Reader = resp.Body
+	var decoded *decodedBody
+	if !dump.rawEncoding {
+		d, err := decodeBody(resp.Header, resp.Body)
+		if _, ok := err.(unsupportedEncodingError); ok {
+			fmt.Fprintf(os.Stderr, "gdhttp: %s, the body is printed as it is\n", err)
+		} else if err != nil {
+			dump.err = err
+			return
+		}
+		if d != nil {
+			body, decoded = d, d
+		}
+	}
+	if dump.stream {
+		dump.err = dump.streamBody(body, resp.Header.Get("Content-Type"))
+		dump.printDecodedSize(decoded)
+		return
 	}
-	body, err := ioutil.ReadAll(resp.Body)
+	data, err := ioutil.ReadAll(body)
 	if err != nil {
-		fmt.Println(string(body))
+		fmt.Println(string(data))
+		dump.err = err
 		return
 	}
+	dump.printDecodedSize(decoded)
+	dump.err = dump.printResponseBody(data, resp.Header.Get("Content-Type"))
+}
 
-	prettyBody, err := prettyJSON(body)
-	if err != nil {
+// printDecodedSize verbose 模式下显示压缩的 body 解压前后的大小
+func (dump *DumpConfig) printDecodedSize(d *decodedBody) {
+	if dump.showEncoding && d != nil {
+		fmt.Println(d)
+	}
+}
+
+// printBody 用 --output-format 对应的 Formatter 输出 JSON, 其他内容原样输出
+func (dump *DumpConfig) printBody(body []byte) error {
+	if !json.Valid(body) {
 		fmt.Println(string(body))
-		return
+		return nil
 	}
+	return dump.formatter.Format(os.Stdout, body)
+}
 
-	bodyStr := string(prettyBody)
-	bodyStr = replaceJSONUnicode(bodyStr)
-	fmt.Println(bodyStr)
+// printFiltered 输出 --filter 的每个结果, --raw-output 时字符串不加引号
+func (dump *DumpConfig) printFiltered(body []byte) error {
+	results, err := dump.filter.run(body)
+	for _, r := range results {
+		if s, ok := r.(string); ok && dump.rawOutput {
+			fmt.Println(s)
+			continue
+		}
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		if err := enc.Encode(r); err != nil {
+			return err
+		}
+		if err := dump.printBody(bytes.TrimRight(buf.Bytes(), "\n")); err != nil {
+			return err
+		}
+	}
+	return err
+}
+
+// formatBody 按照 --pretty 缩进 JSON 并着色, 不是 JSON 时原样返回
+func (dump *DumpConfig) formatBody(body []byte) string {
+	if !json.Valid(body) {
+		return string(body)
+	}
+	s := string(body)
+	if dump.format {
+		if prettyBody, err := prettyJSON(body); err == nil {
+			s = replaceJSONUnicode(string(prettyBody))
+		}
+	}
+	return dump.colors.colorJSON(s)
 }
 
 func prettyJSON(b []byte) ([]byte, error) {
@@ -312,18 +782,57 @@ Positional Arguments:
           $ gdhttp :/foo                    # => http://localhost/foo
           $ gdhttp /foo                    # => http://localhost/foo
 
+      URLs starting with '/' are resolved against the baseURL of the
+      selected profile if it has one:
+
+          $ gdhttp -p dev /api/v1/jobs      # => https://dev.example.com/api/v1/jobs
+
     REQUEST_ITEM
       Optional key-value pairs to be included in the request. The separator used
       determines the type:
 
-      '=' URL parameters to be appended to the request URI:
+      '==' URL parameters to be appended to the request URI:
 
-          $ gdhttp :/foo search=httpie     # => http://localhost/foo?search=httpie
+          $ gdhttp :/foo search==httpie    # => http://localhost/foo?search=httpie
 
-      '==' Parameters to be formating the request URI:
+      A '==' parameter whose name matches a <token> in the URL formats
+      the request URI instead:
 
           $ gdhttp :/<id> id==123           # => http://localhost/123
 
+      '=' Data fields to be serialized into a JSON object, or a form with
+      --form (the method defaults to POST when data fields are given, and
+      GET, HEAD and OPTIONS cannot send them):
+
+          $ gdhttp PUT :/foo name=gdhttp   # => {"name": "gdhttp"}
+
+      ':=' Raw JSON fields:
+
+          $ gdhttp PUT :/foo count:=3 'tags:=["a","b"]'
+
+      The names of '=' and ':=' fields can be paths into nested objects and
+      arrays, '[]' appends to an array and '\.' escapes a dot:
+
+          $ gdhttp PUT :/jobs 'inputs[reads][0]=a.fq' meta.owner=alice 'tags[]=x'
+          # => {"inputs": {"reads": ["a.fq"]}, "meta": {"owner": "alice"}, "tags": ["x"]}
+
+      '=@' Data fields whose value is the content of a file, and ':=@' raw
+      JSON fields read from a file. Use '-' as the file name to read stdin:
+
+          $ gdhttp PUT :/foo description=@notes.txt config:=@settings.json
+          $ cat notes.txt | gdhttp PUT :/foo description=@-
+
+      ':' HTTP headers, an empty value removes the default header:
+
+          $ gdhttp :/foo X-Gd-Project:abc Accept-Encoding:
+
+      '@' Files to be uploaded in a multipart form, requires --form. The
+      MIME type is detected from the file name or its content:
+
+          $ gdhttp -f :/upload name=reads file@/data/a.fq
+
+      Use '\' to escape a separator in the field name, e.g. 'a\=b=c'.
+
 
 Optional Arguments:
     --help, -h
@@ -331,19 +840,131 @@ Optional Arguments:
     --version, -V
         Show version and exit.
     --access-key-id ACCESSKEYID
-        Access key id.
+        Access key id (default: $GDHTTP_ACCESS_KEY_ID).
     --access-key-secret ACCESSKEYSECRET
-        Access key secret.
+        Access key secret (default: $GDHTTP_ACCESS_KEY_SECRET).
     --config CONFIG, -c
-        Configuration file (default: $HOME/.gdhttp.json).
+        Configuration file, the format is detected by the extension: .json,
+        .yaml, .yml or .toml (default: the first existing one of
+        $XDG_CONFIG_HOME/gdhttp/config.{json,yaml,yml,toml} and
+        $HOME/.gdhttp.{json,yaml,yml,toml}, or $HOME/.gdhttp.json).
+    --profile PROFILE, -p
+        The profile in the configuration file to be used
+        (default: $GDHTTP_PROFILE or the defaultProfile of the configuration file).
     --timeout TIMEOUT, -t
         The connection timeout of the request in seconds (default: 30).
     --body, -b
-        Print only the response body.
+        Print only the response body, a shortcut for --print=b.
+    --headers
+        Print only the response headers, a shortcut for --print=h.
     --verbose, -v
-        Verbose output. Print the whole request as well as the response.
+        Verbose output. Print the whole request as well as the response,
+        a shortcut for --print=HBhb.
+    --print WHAT
+        String specifying what the output should contain:
+            'H' request headers
+            'B' request body
+            'h' response headers
+            'b' response body
+        (default: hb). It overrides --body, --headers and --verbose.
+    --pretty PRETTY
+        Controls output processing: 'all' (format and colors), 'colors',
+        'format' (indent JSON) or 'none' (default: all when stdout is a
+        terminal, format otherwise).
+    --style STYLE
+        Color theme used by --pretty=all|colors: default, mono, monokai,
+        solarized (default: default).
+    --download, -d
+        Save the response body to a file instead of printing it. The file
+        name comes from the Content-Disposition header or the URL unless
+        --output is given, the response headers and the progress are
+        printed to stderr. The download is verified against the
+        Content-MD5 or Digest header if the server sends one.
+    --output FILE, -o
+        The file to save the response body to, implies --download.
+    --continue
+        Resume an interrupted download of --output with a Range request.
+    --stream, -S
+        Print the response body as it arrives instead of waiting for the
+        whole body. Each line of NDJSON and each complete JSON value of
+        application/json is formatted on its own, and text/event-stream
+        responses are printed event by event. The
+        --timeout only limits the wait for the response headers.
+    --filter FILTER, -q
+        Print only the parts of the JSON response body selected by a jq-like
+        expression, e.g. '.items[] | select(.status == "done") | .id'.
+        Supported: .a  .a.b  ."a b"  .[0]  .[-1]  .[1:3]  .[]  ..  a | b
+        a, b  [a]  {a: .b}  a?  a // b  == != < <= > >=  and or not
+        length keys has(k) type map(f) select(f) first last sort
+        sort_by(f) add join(s) tostring tonumber empty, and the JSONPath
+        style $ .* [*].
+    --raw-output, -r
+        Print strings selected by --filter without quotes.
+    --output-format FORMAT
+        Format of the JSON response body (default: json):
+            json     indented with --pretty
+            compact  JSON on a single line
+            yaml     YAML
+            table    an array of objects as aligned columns
+            csv      an array of objects as RFC 4180 CSV with a header row
+            raw      the body as it is, strings without quotes
+        It applies to bodies whose Content-Type is application/json or
+        ends with +json. Other bodies are formatted by their Content-Type:
+        XML and HTML are indented, application/x-www-form-urlencoded is
+        decoded into a JSON object, and the charset is converted to UTF-8.
+        Other types are printed as they are, even if they look like JSON.
+    --columns COLUMNS
+        Comma separated keys of the objects to show with
+        --output-format=table|csv (default: all keys).
+    --raw-encoding
+        Print gzip, deflate and br compressed response bodies as they are.
+        They are decoded by default, and --verbose prints their sizes
+        before and after decoding.
+    --force-binary
+        Print a hex dump of a binary response body, e.g. an image, to the
+        terminal instead of a notice. Binary bodies are written as they
+        are when stdout is redirected.
+    --form, -f
+        Send the data fields as application/x-www-form-urlencoded instead of
+        JSON, or as multipart/form-data when there are '@' items, which are
+        uploaded as files without being loaded into memory.
+    --multipart
+        Send the form as multipart/form-data even without '@' items.
+    --ignore-stdin
+        Do not read the request body from stdin, e.g. in scripts where stdin
+        is not a terminal but has nothing to send.
     --no-auth
         Don't add Authorization header.
+    --auth-type AUTHTYPE, -A
+        The authentication mechanism to be used: genedock, basic, bearer,
+        digest (default: genedock).
+    --auth AUTH, -a
+        USER[:PASS] for basic and digest auth, TOKEN for bearer auth.
+    --signature-method SIGNATUREMETHOD
+        The signature method of genedock auth: hmac-sha1-v1, hmac-sha256-v1
+        (default: hmac-sha1-v1).
+    --content-md5
+        Add the Content-MD5 header of the request body and sign it.
+    --debug-signature
+        Print the string-to-sign and signature of genedock auth to stderr.
+
+Subcommands:
+    sign [METHOD] URL [REQUEST_ITEM [REQUEST_ITEM ...]]
+        Print the string-to-sign and signature of the request without sending it.
+
+    config init|get|set|unset|list|validate|edit|which
+        Manage the configuration file, run 'gdhttp config --help' for details.
+
+    verify-server [--listen ADDR] [--max-clock-skew DURATION]
+        Run a local HTTP server which verifies the genedock signature of each
+        incoming request with the key pairs in the configuration file and
+        responds with a JSON report comparing the received Authorization,
+        Date, Content-MD5 and x-gd-* headers with the expected string-to-sign.
+        The signature computed by the server is never returned.
+
+    vault add|remove|list
+        Manage the credentials in the encrypted vault file, run
+        'gdhttp vault --help' for details.
 
 Sample configuration file:
 
@@ -351,15 +972,109 @@ Sample configuration file:
     "auths": {
         "localhost": {
             "accessKeyID" : "id",
-            "accessKeySecret": "secret"
+            "accessKeySecret": "secret",
+            "signatureMethod": "hmac-sha256-v1"
+        },
+        "example.com": {
+            "type": "basic",
+            "username": "user",
+            "password": "pass"
+        }
+    },
+    "credentialHelper": "gdhttp-credential-pass",
+    "vault": "$HOME/.gdhttp.vault",
+    "defaultProfile": "dev",
+    "profiles": {
+        "dev": {
+            "baseURL": "https://dev.example.com",
+            "auth": {
+                "accessKeyID" : "id",
+                "accessKeySecret": "secret"
+            },
+            "headers": {
+                "X-Gd-Project": "abc"
+            },
+            "timeout": 60,
+            "tls": {
+                "insecure": false,
+                "caCert": "$HOME/.gdhttp/ca.pem",
+                "clientCert": "$HOME/.gdhttp/client.pem",
+                "clientKey": "$HOME/.gdhttp/client-key.pem"
+            }
         }
     }
-}`, usageShort())
+}
+
+The same configuration can be written in YAML or TOML, e.g. $HOME/.gdhttp.yaml:
+
+auths:
+  localhost:
+    accessKeyID: id
+    accessKeySecret: secret
+profiles:
+  dev:
+    baseURL: https://dev.example.com
+    headers:
+      X-Gd-Project: abc
+
+Credentials are looked up in the order of the command line arguments, the
+environment variables, the selected profile, the auths of the configuration
+file, the vault and finally the credential helper. The first complete set of
+credentials is used together with its type and signatureMethod, an access key
+ID and secret are never taken from different places.
+
+The keys of auths are match rules of the form '[scheme://]host[:port][/path]',
+the host can be a wildcard like '*.example.com'. A rule without a port only
+matches the default port of the scheme, e.g. 'localhost' matches
+http://localhost/ but not http://localhost:8080/, use 'localhost:8080' for one
+port or 'localhost:*' for any port. When several rules match a URL the most
+specific one wins: exact hosts over wildcards, longer wildcards, longer path
+prefixes, then rules with a port over rules without one over ':*' rules, then
+rules with a scheme.
+
+The vault (default: $HOME/.gdhttp.vault) keeps credentials encrypted with a
+key derived from a passphrase, e.g.
+
+    gdhttp vault add '*.example.com' --access-key-id id
+
+prompts for the access key secret and the passphrase. Only the match rules are
+stored in plain text, the passphrase is asked (or read from
+$GDHTTP_VAULT_PASSPHRASE) when one of them matches the URL.
+
+The credential helper is called as '<credentialHelper> get' with 'protocol',
+'host' and 'path' lines on stdin and should print 'key=value' lines such as
+'accessKeyID=id' and 'accessKeySecret=secret' on stdout.`, usageShort())
 }
 
 func usageShort() string {
 	return `usage: gdhttp [-h | --help] [-V | --version]
               [--access-key-id ACCESSKEYID] [--access-key-secret ACCESSKEYSECRET]
-              [--config CONFIG] [--body] [--no-auth] [--verbose]
+              [--auth-type AUTHTYPE] [--auth AUTH]
+              [--config CONFIG] [--profile PROFILE] [--no-auth]
+              [--body] [--headers] [--print WHAT] [--verbose]
+              [--form] [--multipart] [--ignore-stdin]
+              [--download] [--output FILE] [--continue] [--stream]
+              [--filter FILTER] [--raw-output]
+              [--output-format FORMAT] [--columns COLUMNS]
+              [--force-binary] [--raw-encoding]
               [METHOD] URL [REQUEST_ITEM [REQUEST_ITEM ...]]`
 }
+
+func usageSubcommand(cmd *cobra.Command) string {
+	s := fmt.Sprintf("usage: %s\n", cmd.UseLine())
+	if cmd.HasAvailableSubCommands() {
+		s += "\nCommands:\n"
+		for _, c := range cmd.Commands() {
+			if c.IsAvailableCommand() {
+				s += fmt.Sprintf("    %-12s %s\n", c.Name(), c.Short)
+			}
+		}
+	}
+	if cmd.HasAvailableLocalFlags() {
+		s += "\nOptional Arguments:\n" + cmd.LocalFlags().FlagUsages()
+	}
+	if cmd.HasAvailableInheritedFlags() {
+		s += "\nGlobal Arguments:\n" + cmd.InheritedFlags().FlagUsages()
+	}
+	return strings.TrimRight(s, "\n")
+}
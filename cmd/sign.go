@@ -0,0 +1,80 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"bitbucket.org/mozillazg/gdhttp/auth"
+	"github.com/spf13/cobra"
+)
+
+var signCmd = &cobra.Command{
+	Use:   "sign [METHOD] URL [REQUEST_ITEM [REQUEST_ITEM ...]]",
+	Short: "Print the string-to-sign and signature of the request without sending it",
+	Run: func(cmd *cobra.Command, args []string) {
+		initConfig(cmd)
+		pa := loadRequest(args)
+		initAuth()
+
+		authenticator, err := newAuthenticator()
+		if err != nil {
+			exitWithError(err)
+		}
+		sign, ok := authenticator.(*auth.Signature)
+		if !ok {
+			exitWithError(errors.New("sign only supports the genedock auth type"))
+		}
+		c := NewClient(sign, 0)
+		req, err := c.newRequest(httpMethod, uri, pa.items.headers, reqBody)
+		if err != nil {
+			exitWithError(err)
+		}
+		if err = printSignature(os.Stdout, sign, req); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+func init() {
+	addRequestFlags(signCmd.Flags())
+	RootCmd.AddCommand(signCmd)
+}
+
+// printSignature 输出已签名的 req 参与签名的各个部分以及签名结果
+func printSignature(w io.Writer, sign *auth.Signature, req *http.Request) error {
+	c := sign.Canonicalize(req)
+	s, err := sign.Sign(c)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(w, "Signature method:\n%s\n\n", sign.Method)
+	fmt.Fprintf(w, "Canonical resource:\n%s\n\n", c.Resource)
+	fmt.Fprintf(w, "Canonical headers:\n%s\n\n", c.Headers)
+	fmt.Fprintf(w, "Date:\n%s\n\n", c.Date)
+	fmt.Fprintf(w, "String to sign:\n%s\n\n", c.String())
+	fmt.Fprintf(w, "Authorization:\n%s\n", sign.AuthorizationHeader(s))
+	return nil
+}
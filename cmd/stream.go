@@ -0,0 +1,171 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"os"
+	"strings"
+)
+
+// 按行输出的 JSON 流的 Content-Type
+var lineDelimitedJSONTypes = map[string]bool{
+	"application/x-ndjson":     true,
+	"application/ndjson":       true,
+	"application/jsonl":        true,
+	"application/x-jsonlines":  true,
+	"application/stream+json":  true,
+	"application/json-seq":     true,
+	"application/x-json-lines": true,
+}
+
+// sseEvent text/event-stream 中的一个事件
+type sseEvent struct {
+	event string
+	id    string
+	retry string
+	data  []string
+}
+
+// streamBody 边接收边输出 response body: NDJSON 逐行格式化, application/json
+// 逐个格式化其中的 JSON 值, text/event-stream 解析成一个个事件, 其他类型原样输出
+func (dump *DumpConfig) streamBody(body io.Reader, contentType string) error {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "text/event-stream":
+		return dump.streamEvents(body)
+	case lineDelimitedJSONTypes[mediaType]:
+		return dump.streamLines(body)
+	case mediaType == "application/json":
+		return dump.streamJSON(body)
+	}
+	_, err := io.Copy(os.Stdout, body)
+	return err
+}
+
+func (dump *DumpConfig) streamLines(body io.Reader) error {
+	r := bufio.NewReader(body)
+	for {
+		line, err := r.ReadString('\n')
+		// application/json-seq 的每条记录以 RS (0x1E) 开头
+		if s := strings.TrimRight(strings.TrimLeft(line, "\x1e"), "\r\n"); s != "" {
+			var e error
+			if dump.filter == nil {
+				e = dump.printBody([]byte(s))
+			} else {
+				e = dump.printFiltered([]byte(s))
+			}
+			if e != nil {
+				return e
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// streamJSON 每读到一个完整的 JSON 值就输出一次, 这样既支持用 application/json
+// 发送的 NDJSON, 也支持跨多行的单个 JSON 文档. 遇到不是 JSON 的内容时原样输出剩下的部分
+func (dump *DumpConfig) streamJSON(body io.Reader) error {
+	dec := json.NewDecoder(body)
+	for {
+		var v json.RawMessage
+		err := dec.Decode(&v)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			_, err = io.Copy(os.Stdout, io.MultiReader(dec.Buffered(), body))
+			return err
+		}
+		if dump.filter == nil {
+			err = dump.printBody(v)
+		} else {
+			err = dump.printFiltered(v)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// streamEvents 按照 https://html.spec.whatwg.org/multipage/server-sent-events.html
+// 解析事件, 每收到一个完整的事件就输出一次
+func (dump *DumpConfig) streamEvents(body io.Reader) error {
+	r := bufio.NewReader(body)
+	event := sseEvent{}
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return err
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			// 空行表示事件结束, 连接关闭时未结束的事件被丢弃
+			if err == nil && (event.data != nil || event.event != "" || event.id != "") {
+				dump.printEvent(event)
+			}
+			event = sseEvent{}
+		} else if !strings.HasPrefix(line, ":") {
+			field, value := line, ""
+			if n := strings.Index(line, ":"); n >= 0 {
+				field, value = line[:n], strings.TrimPrefix(line[n+1:], " ")
+			}
+			switch field {
+			case "event":
+				event.event = value
+			case "id":
+				event.id = value
+			case "retry":
+				event.retry = value
+			case "data":
+				event.data = append(event.data, value)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+	}
+}
+
+func (dump *DumpConfig) printEvent(event sseEvent) {
+	field := func(name, value string) {
+		if value != "" {
+			fmt.Printf("%s: %s\n", dump.colors.paintName(name), value)
+		}
+	}
+	field("event", event.event)
+	field("id", event.id)
+	field("retry", event.retry)
+	if event.data != nil {
+		fmt.Printf("%s: %s\n", dump.colors.paintName("data"),
+			dump.formatBody([]byte(strings.Join(event.data, "\n"))))
+	}
+	fmt.Println()
+}
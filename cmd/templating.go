@@ -21,12 +21,13 @@
 package cmd
 
 import (
-	"regexp"
 	"fmt"
+	"regexp"
 	"strings"
 )
 
 var reToken = regexp.MustCompile("<([^<>]+)>")
+
 const tokenLeft = "<"
 const tokenRight = ">"
 
@@ -44,3 +45,13 @@ func substitute(s string, mapping map[string]interface{}) string {
 	})
 	return s
 }
+
+// 模板中用到的变量名
+// tokens("/api/v1/jobs/<id>") -> []string{"id"}
+func tokens(s string) []string {
+	names := []string{}
+	for _, m := range reToken.FindAllStringSubmatch(s, -1) {
+		names = append(names, m[1])
+	}
+	return names
+}
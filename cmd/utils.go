@@ -35,18 +35,14 @@ import (
 )
 
 var reJSONUnicode = regexp.MustCompile("\\\\u[a-z\\d]{4}")
-var reQueryItem = regexp.MustCompile("^([^=]+)=($|[^=](.*)$)")
 var reURLOnlyPort = regexp.MustCompile("^:\\d+")
 var reURLHasScheme = regexp.MustCompile("^https?://")
-var reURLFormat = regexp.MustCompile("^([^=]+)==(.*)$")
-
-const queryItemFlag = "="
-const formatItemFlag = "=="
 
 type PositionalArgument struct {
 	httpMethod   string
 	uri          *url.URL
 	requestItems []string
+	items        RequestItems
 }
 
 // 解析位置参数
@@ -56,7 +52,6 @@ func parsePositionalArguments(args []string) (p PositionalArgument, err error) {
 		return
 	}
 
-	p.httpMethod = http.MethodGet
 	uriStr := ""
 	p.requestItems = []string{}
 
@@ -69,7 +64,7 @@ func parsePositionalArguments(args []string) (p PositionalArgument, err error) {
 			uriStr = args[1]
 			p.requestItems = args[2:]
 		} else {
-			p.httpMethod = http.MethodGet
+			p.httpMethod = ""
 			uriStr = args[0]
 			for _, item := range args[1:] {
 				p.requestItems = append(p.requestItems, item)
@@ -77,7 +72,20 @@ func parsePositionalArguments(args []string) (p PositionalArgument, err error) {
 		}
 	}
 
-	p.uri, err = buildURL(uriStr, p.requestItems)
+	p.items, err = parseRequestItems(p.requestItems)
+	if err != nil {
+		return
+	}
+	// 未指定 method 时, 有 data 参数的默认使用 POST
+	if p.httpMethod == "" {
+		p.httpMethod = http.MethodGet
+		if p.items.hasData() {
+			p.httpMethod = http.MethodPost
+		}
+	}
+	p.items.pullTemplateParams(uriStr)
+
+	p.uri, err = buildURL(uriStr, p.items)
 	if err != nil {
 		return
 	}
@@ -112,8 +120,17 @@ func isValidMethod(method string) bool {
 	return false
 }
 
-func buildURL(uri string, requestItems []string) (u *url.URL, err error) {
-	uri = fillURL(uri, requestItems)
+// methodHasBody 这些 method 不发送 request body, 从 stdin 读取的 body 会被忽略
+func methodHasBody(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	return true
+}
+
+func buildURL(uri string, items RequestItems) (u *url.URL, err error) {
+	uri = fillURL(uri, items.template)
 
 	u, err = url.Parse(uri)
 	if err != nil {
@@ -124,10 +141,9 @@ func buildURL(uri string, requestItems []string) (u *url.URL, err error) {
 	}
 
 	queryItems := u.Query()
-	for _, item := range requestItems {
-		if reQueryItem.Match([]byte(item)) {
-			arr := strings.Split(item, queryItemFlag)
-			queryItems.Add(arr[0], arr[1])
+	for key, values := range items.query {
+		for _, value := range values {
+			queryItems.Add(key, value)
 		}
 	}
 	u.RawQuery = queryItems.Encode()
@@ -162,7 +178,9 @@ func absPathify(inPath string) (string, error) {
 	return inPath, nil
 }
 
-func fillURL(uri string, requestItems []string) string {
+func fillURL(uri string, formatMapping map[string]interface{}) string {
+	// /xxx -> <baseURL>/xxx
+	uri = resolveBaseURL(uri, profile.BaseURL)
 	// :8000/xxx -> 127.0.0.1:8000/xxx
 	if reURLOnlyPort.Match([]byte(uri)) {
 		uri = fmt.Sprintf("%s%s", defaultHost, uri)
@@ -176,13 +194,6 @@ func fillURL(uri string, requestItems []string) string {
 		uri = fmt.Sprintf("%s://%s", defaultScheme, uri)
 	}
 	// /<id> id==123  ->  /123
-	formatMapping := map[string]interface{}{}
-	for _, item := range requestItems {
-		if reURLFormat.Match([]byte(item)) {
-			arr := strings.Split(item, formatItemFlag)
-			formatMapping[arr[0]] = url.PathEscape(arr[1])
-		}
-	}
 	uri = substitute(uri, formatMapping)
 
 	return uri
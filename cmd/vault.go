@@ -0,0 +1,386 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"bitbucket.org/mozillazg/gdhttp/auth"
+	"github.com/spf13/cobra"
+	"golang.org/x/crypto/scrypt"
+)
+
+const defaultVaultPath = "$HOME/.gdhttp.vault"
+const vaultPassphraseEnv = "GDHTTP_VAULT_PASSPHRASE"
+
+const vaultVersion = 1
+const vaultKDF = "scrypt"
+
+// scrypt 参数, 见 https://godoc.org/golang.org/x/crypto/scrypt
+const (
+	vaultScryptN = 1 << 15
+	vaultScryptR = 8
+	vaultScryptP = 1
+	vaultKeyLen  = 32
+	vaultSaltLen = 16
+)
+
+// vaultFile 加密保存凭证的 vault 文件. 只有匹配规则是明文的,
+// 这样不匹配的请求不需要输入 passphrase; 凭证用 scrypt 生成的 key 以
+// AES-256-GCM 加密, 匹配规则作为 additional data 防止被篡改.
+type vaultFile struct {
+	Version    int      `json:"version"`
+	KDF        string   `json:"kdf"`
+	N          int      `json:"n"`
+	R          int      `json:"r"`
+	P          int      `json:"p"`
+	Salt       []byte   `json:"salt"`
+	Nonce      []byte   `json:"nonce"`
+	Rules      []string `json:"rules"`
+	Ciphertext []byte   `json:"ciphertext"`
+}
+
+var vaultCmd = &cobra.Command{
+	Use:   "vault",
+	Short: "Manage credentials in the encrypted vault",
+}
+
+var vaultAddCmd = &cobra.Command{
+	Use:   "add RULE",
+	Short: "Add or replace the credentials for an auths rule, e.g. *.example.com",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			exitWithError(fmt.Errorf("usage: %s", cmd.UseLine()))
+		}
+		rule := args[0]
+		if _, err := parseHostRule(rule); err != nil {
+			exitWithError(err)
+		}
+		initConfig(cmd)
+		value, err := promptAuth()
+		if err != nil {
+			exitWithError(err)
+		}
+
+		p := mustVaultPath()
+		v, passphrase, entries := mustUnlockVault(p, true)
+		entries[rule] = value
+		if err = saveVault(p, v, passphrase, entries); err != nil {
+			exitWithError(err)
+		}
+		fmt.Printf("Saved credentials for %s to %s\n", rule, p)
+	},
+}
+
+var vaultRemoveCmd = &cobra.Command{
+	Use:   "remove RULE",
+	Short: "Remove the credentials for an auths rule",
+	Run: func(cmd *cobra.Command, args []string) {
+		if len(args) != 1 {
+			exitWithError(fmt.Errorf("usage: %s", cmd.UseLine()))
+		}
+		initConfig(cmd)
+		p := mustVaultPath()
+		v, passphrase, entries := mustUnlockVault(p, false)
+		if _, ok := entries[args[0]]; !ok {
+			exitWithError(fmt.Errorf("no credentials for %q in %s", args[0], p))
+		}
+		delete(entries, args[0])
+		if err := saveVault(p, v, passphrase, entries); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+var vaultListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List the rules in the vault, secrets are hidden unless --show-secrets is given",
+	Run: func(cmd *cobra.Command, args []string) {
+		initConfig(cmd)
+		p := mustVaultPath()
+		_, _, entries := mustUnlockVault(p, false)
+		for _, rule := range sortedVaultRules(entries) {
+			value := entries[rule]
+			if !configShowSecrets {
+				value = value.masked()
+			}
+			b, _ := json.Marshal(value)
+			fmt.Printf("%s = %s\n", rule, b)
+		}
+	},
+}
+
+func init() {
+	vaultListCmd.Flags().BoolVar(&configShowSecrets, "show-secrets", false, "Show secrets instead of hiding them")
+
+	vaultCmd.AddCommand(
+		vaultAddCmd,
+		vaultRemoveCmd,
+		vaultListCmd,
+	)
+	RootCmd.AddCommand(vaultCmd)
+}
+
+// vaultAuth 返回 vault 中匹配 u 的凭证, 只有存在匹配的规则时才会要求输入 passphrase
+func vaultAuth(u *url.URL) (value configAuth, ok bool, err error) {
+	p, err := vaultPath()
+	if err != nil {
+		return
+	}
+	v, err := readVault(p)
+	if err != nil || v == nil {
+		return
+	}
+	rules := map[string]configAuth{}
+	for _, rule := range v.Rules {
+		rules[rule] = configAuth{}
+	}
+	keys := matchAuths(rules, u)
+	if len(keys) == 0 {
+		return
+	}
+
+	passphrase, err := vaultPassphrase(fmt.Sprintf("Passphrase for %s: ", p), false)
+	if err != nil {
+		return
+	}
+	entries, err := v.open(passphrase)
+	if err != nil {
+		return
+	}
+	value, ok = entries[keys[0]]
+	return
+}
+
+func vaultPath() (string, error) {
+	if config.Vault != "" {
+		return absPathify(config.Vault)
+	}
+	return absPathify(defaultVaultPath)
+}
+
+func mustVaultPath() string {
+	p, err := vaultPath()
+	if err != nil {
+		exitWithError(err)
+	}
+	return p
+}
+
+// mustUnlockVault 读取并解密 vault, vault 不存在且 create 为 true 时
+// 询问新的 passphrase 并返回空的 vault
+func mustUnlockVault(p string, create bool) (*vaultFile, string, map[string]configAuth) {
+	v, err := readVault(p)
+	if err != nil {
+		exitWithError(err)
+	}
+	if v == nil {
+		if !create {
+			exitWithError(fmt.Errorf("%s does not exist, use `gdhttp vault add` to create it", p))
+		}
+		passphrase, err := vaultPassphrase(fmt.Sprintf("New passphrase for %s: ", p), true)
+		if err != nil {
+			exitWithError(err)
+		}
+		return nil, passphrase, map[string]configAuth{}
+	}
+
+	passphrase, err := vaultPassphrase(fmt.Sprintf("Passphrase for %s: ", p), false)
+	if err != nil {
+		exitWithError(err)
+	}
+	entries, err := v.open(passphrase)
+	if err != nil {
+		exitWithError(err)
+	}
+	return v, passphrase, entries
+}
+
+// vaultPassphrase 优先使用 GDHTTP_VAULT_PASSPHRASE, 否则从终端读取
+func vaultPassphrase(prompt string, confirm bool) (string, error) {
+	if s := os.Getenv(vaultPassphraseEnv); s != "" {
+		return s, nil
+	}
+	passphrase, err := readPassword(prompt)
+	if err != nil {
+		return "", fmt.Errorf("read vault passphrase: %s (set %s to avoid the prompt)", err, vaultPassphraseEnv)
+	}
+	if passphrase == "" {
+		return "", errors.New("empty vault passphrase")
+	}
+	if confirm {
+		again, err := readPassword("Repeat passphrase: ")
+		if err != nil {
+			return "", err
+		}
+		if again != passphrase {
+			return "", errors.New("passphrases do not match")
+		}
+	}
+	return passphrase, nil
+}
+
+// promptAuth 根据命令行参数生成 vault 中的凭证, 没有给出的 secret 从终端读取
+func promptAuth() (value configAuth, err error) {
+	value.Type = strings.ToLower(authType)
+	value.SignatureMethod = signatureMethod
+	switch value.Type {
+	case "", auth.TypeGeneDock:
+		value.AccessKeyID = accessKeyID
+		value.AccessKeySecret = accessKeySecret
+		if value.AccessKeyID == "" {
+			if value.AccessKeyID, err = readLine("Access key id: "); err != nil {
+				return
+			}
+		}
+		if value.AccessKeySecret == "" {
+			value.AccessKeySecret, err = readPassword("Access key secret: ")
+		}
+	case auth.TypeBasic, auth.TypeDigest:
+		arr := strings.SplitN(authCredentials, ":", 2)
+		value.Username = arr[0]
+		if len(arr) > 1 {
+			value.Password = arr[1]
+		}
+		if value.Username == "" {
+			if value.Username, err = readLine("Username: "); err != nil {
+				return
+			}
+		}
+		if value.Password == "" {
+			value.Password, err = readPassword("Password: ")
+		}
+	case auth.TypeBearer:
+		value.Token = authCredentials
+		if value.Token == "" {
+			value.Token, err = readPassword("Token: ")
+		}
+	default:
+		err = fmt.Errorf("unsupported auth type %q", authType)
+	}
+	return
+}
+
+// readVault 读取 vault 文件, 文件不存在时返回 nil
+func readVault(p string) (*vaultFile, error) {
+	data, err := ioutil.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	v := &vaultFile{}
+	if err = json.Unmarshal(data, v); err != nil {
+		return nil, fmt.Errorf("parse vault file %s error: %s", p, err)
+	}
+	if v.Version != vaultVersion || v.KDF != vaultKDF {
+		return nil, fmt.Errorf("unsupported vault file %s: version %d, kdf %q", p, v.Version, v.KDF)
+	}
+	return v, nil
+}
+
+// saveVault 加密 entries 并写入 vault 文件, 每次保存都使用新的 salt 和 nonce
+func saveVault(p string, old *vaultFile, passphrase string, entries map[string]configAuth) error {
+	v := &vaultFile{
+		Version: vaultVersion,
+		KDF:     vaultKDF,
+		N:       vaultScryptN,
+		R:       vaultScryptR,
+		P:       vaultScryptP,
+		Salt:    make([]byte, vaultSaltLen),
+		Rules:   sortedVaultRules(entries),
+	}
+	if old != nil {
+		v.N, v.R, v.P = old.N, old.R, old.P
+	}
+	if _, err := rand.Read(v.Salt); err != nil {
+		return err
+	}
+	aead, err := v.aead(passphrase)
+	if err != nil {
+		return err
+	}
+	v.Nonce = make([]byte, aead.NonceSize())
+	if _, err = rand.Read(v.Nonce); err != nil {
+		return err
+	}
+	plaintext, err := json.Marshal(entries)
+	if err != nil {
+		return err
+	}
+	v.Ciphertext = aead.Seal(nil, v.Nonce, plaintext, v.additionalData())
+
+	data, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeConfigFile(p, append(data, '\n'))
+}
+
+// open 解密 vault 中的凭证
+func (v *vaultFile) open(passphrase string) (entries map[string]configAuth, err error) {
+	aead, err := v.aead(passphrase)
+	if err != nil {
+		return
+	}
+	plaintext, err := aead.Open(nil, v.Nonce, v.Ciphertext, v.additionalData())
+	if err != nil {
+		return nil, errors.New("unlock vault: wrong passphrase or corrupted vault file")
+	}
+	err = json.Unmarshal(plaintext, &entries)
+	return
+}
+
+func (v *vaultFile) aead(passphrase string) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), v.Salt, v.N, v.R, v.P, vaultKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (v *vaultFile) additionalData() []byte {
+	return []byte(fmt.Sprintf("gdhttp-vault-v%d\n%s", v.Version, strings.Join(v.Rules, "\n")))
+}
+
+func sortedVaultRules(entries map[string]configAuth) []string {
+	rules := make([]string, 0, len(entries))
+	for rule := range entries {
+		rules = append(rules, rule)
+	}
+	sort.Strings(rules)
+	return rules
+}
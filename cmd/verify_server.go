@@ -0,0 +1,225 @@
+// Copyright © 2017 mozillazg
+//
+// Permission is hereby granted, free of charge, to any person obtaining a copy
+// of this software and associated documentation files (the "Software"), to deal
+// in the Software without restriction, including without limitation the rights
+// to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+// copies of the Software, and to permit persons to whom the Software is
+// furnished to do so, subject to the following conditions:
+//
+// The above copyright notice and this permission notice shall be included in
+// all copies or substantial portions of the Software.
+//
+// THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+// IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+// FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+// AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+// LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+// OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN
+// THE SOFTWARE.
+
+package cmd
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"bitbucket.org/mozillazg/gdhttp/auth"
+	"github.com/spf13/cobra"
+)
+
+const defaultVerifyListen = "127.0.0.1:8000"
+const defaultMaxClockSkew = 15 * time.Minute
+
+var verifyListen string
+var verifyMaxClockSkew time.Duration
+
+var verifyServerCmd = &cobra.Command{
+	Use:   "verify-server",
+	Short: "Run a local HTTP server which verifies the genedock signature of incoming requests",
+	Run: func(cmd *cobra.Command, args []string) {
+		config := loadConfig()
+		keys := map[string]configAuth{}
+		values := []configAuth{}
+		for _, value := range config.Auths {
+			values = append(values, value)
+		}
+		for _, p := range config.Profiles {
+			values = append(values, p.Auth)
+		}
+		for _, value := range values {
+			if value.AccessKeyID != "" && value.AccessKeySecret != "" {
+				keys[value.AccessKeyID] = value
+			}
+		}
+		if accessKeyID != "" {
+			keys[accessKeyID] = configAuth{
+				AccessKeyID:     accessKeyID,
+				AccessKeySecret: accessKeySecret,
+				SignatureMethod: signatureMethod,
+			}
+		}
+
+		handler := &verifyHandler{keys: keys, maxClockSkew: verifyMaxClockSkew}
+		fmt.Fprintf(os.Stderr, "Verifying signatures with %d key(s) on http://%s/\n",
+			len(keys), verifyListen)
+		if err := http.ListenAndServe(verifyListen, handler); err != nil {
+			exitWithError(err)
+		}
+	},
+}
+
+func init() {
+	verifyServerCmd.Flags().StringVarP(&verifyListen, "listen", "l", defaultVerifyListen, "The address to listen on")
+	verifyServerCmd.Flags().DurationVar(&verifyMaxClockSkew, "max-clock-skew", defaultMaxClockSkew, "The maximum allowed difference between the Date header and the server time")
+	RootCmd.AddCommand(verifyServerCmd)
+}
+
+// verifyReport verify-server 对每个请求返回的检查结果.
+// 不返回服务端计算出的签名, 否则任何人都可以用它为任意请求获取有效的签名
+type verifyReport struct {
+	Match                  bool           `json:"match"`
+	AccessKeyID            string         `json:"accessKeyID"`
+	SignatureMethod        string         `json:"signatureMethod"`
+	ReceivedSignature      string         `json:"receivedSignature"`
+	ExpectedStringToSign   string         `json:"expectedStringToSign"`
+	MatchedSignatureMethod string         `json:"matchedSignatureMethod,omitempty"`
+	Received               verifyReceived `json:"received"`
+	Date                   string         `json:"date"`
+	ServerDate             string         `json:"serverDate"`
+	ClockSkew              string         `json:"clockSkew"`
+	ClockSkewOK            bool           `json:"clockSkewOK"`
+	ContentMD5OK           *bool          `json:"contentMD5OK,omitempty"`
+	Errors                 []string       `json:"errors,omitempty"`
+}
+
+// verifyReceived 服务端收到的参与签名的各个部分, 用于和客户端的 string-to-sign 对比
+type verifyReceived struct {
+	Authorization    string      `json:"authorization"`
+	Method           string      `json:"method"`
+	ContentMD5       string      `json:"contentMD5"`
+	ContentType      string      `json:"contentType"`
+	Date             string      `json:"date"`
+	Headers          http.Header `json:"headers"` // 收到的 x-gd-* headers
+	CanonicalHeaders string      `json:"canonicalHeaders"`
+	Resource         string      `json:"resource"`
+}
+
+type verifyHandler struct {
+	keys         map[string]configAuth
+	maxClockSkew time.Duration
+}
+
+func (h *verifyHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	report := h.verify(req)
+
+	status := http.StatusOK
+	if !report.Match || !report.ClockSkewOK ||
+		(report.ContentMD5OK != nil && !*report.ContentMD5OK) {
+		status = http.StatusUnauthorized
+	}
+	fmt.Fprintf(os.Stderr, "%s %s %s %d\n", time.Now().Format(time.RFC3339),
+		req.Method, req.URL.RequestURI(), status)
+
+	b, _ := json.MarshalIndent(report, "", "  ")
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func (h *verifyHandler) verify(req *http.Request) (report verifyReport) {
+	now := time.Now().UTC()
+	report.ServerDate = now.Format(http.TimeFormat)
+	report.Date = req.Header.Get("Date")
+
+	if date, err := http.ParseTime(report.Date); err != nil {
+		report.Errors = append(report.Errors, fmt.Sprintf("invalid Date header %q", report.Date))
+	} else {
+		skew := now.Sub(date)
+		report.ClockSkew = skew.String()
+		report.ClockSkewOK = skew <= h.maxClockSkew && -skew <= h.maxClockSkew
+	}
+
+	if contentMD5 := req.Header.Get("Content-MD5"); contentMD5 != "" {
+		body, err := ioutil.ReadAll(req.Body)
+		if err != nil {
+			report.Errors = append(report.Errors, err.Error())
+		}
+		sum := md5.Sum(body)
+		ok := base64.StdEncoding.EncodeToString(sum[:]) == contentMD5
+		report.ContentMD5OK = &ok
+	}
+
+	// string-to-sign 只取决于 request, 和 access key 无关
+	c := (&auth.Signature{}).Canonicalize(req)
+	report.ExpectedStringToSign = c.String()
+	report.Received = verifyReceived{
+		Authorization:    req.Header.Get("Authorization"),
+		Method:           c.Method,
+		ContentMD5:       c.ContentMD5,
+		ContentType:      c.ContentType,
+		Date:             c.Date,
+		Headers:          http.Header{},
+		CanonicalHeaders: c.Headers,
+		Resource:         c.Resource,
+	}
+	for key, values := range req.Header {
+		if strings.HasPrefix(strings.ToLower(key), "x-gd-") {
+			report.Received.Headers[key] = values
+		}
+	}
+
+	// Authorization: GeneDock <AccessKeyID>:<Signature>
+	value := report.Received.Authorization
+	prefix := "GeneDock "
+	arr := strings.SplitN(strings.TrimPrefix(value, prefix), ":", 2)
+	if !strings.HasPrefix(value, prefix) || len(arr) != 2 {
+		report.Errors = append(report.Errors, fmt.Sprintf("invalid Authorization header %q", value))
+		return
+	}
+	report.AccessKeyID = arr[0]
+	report.ReceivedSignature = arr[1]
+
+	key, ok := h.keys[report.AccessKeyID]
+	if !ok {
+		report.Errors = append(report.Errors, fmt.Sprintf("unknown access key id %q", report.AccessKeyID))
+		return
+	}
+	report.SignatureMethod = key.SignatureMethod
+	if report.SignatureMethod == "" {
+		report.SignatureMethod = auth.HMACSHA1V1
+	}
+
+	sign := &auth.Signature{
+		Method:          report.SignatureMethod,
+		AccessKeyID:     key.AccessKeyID,
+		AccessKeySecret: key.AccessKeySecret,
+	}
+	expected, err := sign.Sign(c)
+	if err != nil {
+		report.Errors = append(report.Errors, err.Error())
+		return
+	}
+	report.Match = expected == report.ReceivedSignature
+	if report.Match {
+		return
+	}
+
+	// 签名不一致时看看客户端是不是用了别的签名方法
+	for _, method := range auth.SignatureMethods {
+		sign.Method = method
+		if s, err := sign.Sign(c); err == nil && s == report.ReceivedSignature {
+			report.MatchedSignatureMethod = method
+			report.Errors = append(report.Errors, fmt.Sprintf(
+				"signature was computed with %s instead of %s", method, report.SignatureMethod))
+		}
+	}
+	return
+}